@@ -0,0 +1,396 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
+	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/exporter"
+	"github.com/ragnarpa/gh-rate-limit-exporter/server"
+	"github.com/spf13/afero"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Name is the name of the exporter binary.
+const Name = "gh-rate-limit-exporter"
+
+// EnvPrefix is the prefix of the environment variables
+// which configure the exporter.
+const EnvPrefix = "GHRLE_"
+
+// Credential sources.
+const (
+	SourceFile       = "file"
+	SourceEnv        = "env"
+	SourceKubernetes = "kubernetes"
+	SourceVault      = "vault"
+)
+
+// Version is the version of the exporter. It is set at build time.
+var Version = "dev"
+
+// Config is the configuration of the exporter binary. The configuration
+// is read from (in the order of precedence) command-line flags,
+// environment variables, the configuration file and the defaults.
+type Config struct {
+	ConfigFile                string        `yaml:"-"`
+	ShowVersion               bool          `yaml:"-"`
+	CredentialsSource         string        `yaml:"credentials_source"`
+	CredentialsFile           string        `yaml:"credentials_file"`
+	CredentialsReloadInterval time.Duration `yaml:"credentials_reload_interval"`
+	KubernetesKubeconfig      string        `yaml:"kubernetes_kubeconfig"`
+	KubernetesNamespace       string        `yaml:"kubernetes_namespace"`
+	KubernetesSelector        string        `yaml:"kubernetes_selector"`
+	VaultAddress              string        `yaml:"vault_address"`
+	VaultMount                string        `yaml:"vault_mount"`
+	VaultPath                 string        `yaml:"vault_path"`
+	VaultAuth                 string        `yaml:"vault_auth"`
+	VaultAuthMount            string        `yaml:"vault_auth_mount"`
+	VaultTokenFile            string        `yaml:"vault_token_file"`
+	VaultRoleID               string        `yaml:"vault_role_id"`
+	VaultSecretIDFile         string        `yaml:"vault_secret_id_file"`
+	VaultRole                 string        `yaml:"vault_role"`
+	VaultJWTFile              string        `yaml:"vault_jwt_file"`
+	VaultRefreshInterval      time.Duration `yaml:"vault_refresh_interval"`
+	Interval                  time.Duration `yaml:"interval"`
+	StaleIntervals            int64         `yaml:"stale_intervals"`
+	CollectionTimeout         time.Duration `yaml:"collection_timeout"`
+	Concurrency               int64         `yaml:"concurrency"`
+	MaxRetries                int64         `yaml:"max_retries"`
+	InstallationInterval      time.Duration `yaml:"installation_interval"`
+	ListenAddress             string        `yaml:"listen_address"`
+	WebConfigFile             string        `yaml:"web_config_file"`
+	LogLevel                  string        `yaml:"log_level"`
+	LogFormat                 string        `yaml:"log_format"`
+	MetricNamespace           string        `yaml:"metrics_namespace"`
+}
+
+func Default() Config {
+	return Config{
+		CredentialsSource:         SourceFile,
+		CredentialsFile:           exporter.FileCredentialFileName,
+		CredentialsReloadInterval: time.Minute,
+		KubernetesSelector:        exporter.DefaultKubernetesSelector,
+		VaultMount:                "secret",
+		VaultAuth:                 exporter.VaultAuthToken,
+		VaultJWTFile:              "/var/run/secrets/kubernetes.io/serviceaccount/token",
+		VaultRefreshInterval:      5 * time.Minute,
+		Interval:                  30 * time.Second,
+		CollectionTimeout:         exporter.DefaultCollectionTimeout,
+		Concurrency:               exporter.DefaultConcurrency,
+		MaxRetries:                exporter.DefaultMaxRetries,
+		InstallationInterval:      exporter.DefaultInstallationInterval,
+		ListenAddress:             ":" + server.Port,
+		LogLevel:                  "info",
+		LogFormat:                 string(logger.FormatJSON),
+		MetricNamespace:           exporter.DefaultNamespace,
+	}
+}
+
+func (c *Config) flagSet(out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(Name, flag.ContinueOnError)
+	fs.SetOutput(out)
+
+	fs.StringVar(&c.ConfigFile, "config.file", c.ConfigFile, "Path of the configuration file.")
+	fs.BoolVar(&c.ShowVersion, "version", c.ShowVersion, "Print the version and exit.")
+	fs.StringVar(&c.CredentialsSource, "credentials.source", c.CredentialsSource, "Where the credentials are read from. One of: file, env, kubernetes, vault.")
+	fs.StringVar(&c.CredentialsFile, "credentials.file", c.CredentialsFile, "Path of the credentials file or of a directory with one file per credential.")
+	fs.DurationVar(&c.CredentialsReloadInterval, "credentials.reload-interval", c.CredentialsReloadInterval, "How often the credentials are checked for changes. Zero disables the periodic checks, SIGHUP always triggers a reload.")
+	fs.StringVar(&c.KubernetesKubeconfig, "credentials.kubernetes.kubeconfig", c.KubernetesKubeconfig, "Path of the kubeconfig file. Defaults to the in-cluster configuration.")
+	fs.StringVar(&c.KubernetesNamespace, "credentials.kubernetes.namespace", c.KubernetesNamespace, "Namespace of the credential Secrets. Defaults to the namespace the exporter runs in, or all namespaces outside of a cluster.")
+	fs.StringVar(&c.KubernetesSelector, "credentials.kubernetes.selector", c.KubernetesSelector, "Label selector of the credential Secrets.")
+	fs.StringVar(&c.VaultAddress, "credentials.vault.address", c.VaultAddress, "Address of the Vault server. Defaults to VAULT_ADDR.")
+	fs.StringVar(&c.VaultMount, "credentials.vault.mount", c.VaultMount, "Mount of the Vault KV v2 secrets engine.")
+	fs.StringVar(&c.VaultPath, "credentials.vault.path", c.VaultPath, "Path of the Vault secret or, if it ends with a slash, the prefix of the secrets with the credentials.")
+	fs.StringVar(&c.VaultAuth, "credentials.vault.auth", c.VaultAuth, "Vault auth method. One of: token, approle, kubernetes.")
+	fs.StringVar(&c.VaultAuthMount, "credentials.vault.auth-mount", c.VaultAuthMount, "Mount of the Vault auth method. Defaults to the name of the auth method.")
+	fs.StringVar(&c.VaultTokenFile, "credentials.vault.token-file", c.VaultTokenFile, "File with the Vault token of the token auth method. Defaults to VAULT_TOKEN.")
+	fs.StringVar(&c.VaultRoleID, "credentials.vault.role-id", c.VaultRoleID, "Role ID of the approle auth method.")
+	fs.StringVar(&c.VaultSecretIDFile, "credentials.vault.secret-id-file", c.VaultSecretIDFile, "File with the secret ID of the approle auth method.")
+	fs.StringVar(&c.VaultRole, "credentials.vault.role", c.VaultRole, "Role of the kubernetes auth method.")
+	fs.StringVar(&c.VaultJWTFile, "credentials.vault.jwt-file", c.VaultJWTFile, "File with the service account token of the kubernetes auth method.")
+	fs.DurationVar(&c.VaultRefreshInterval, "credentials.vault.refresh-interval", c.VaultRefreshInterval, "How often the Vault secrets are re-read.")
+	fs.DurationVar(&c.Interval, "collector.interval", c.Interval, "How often the rate limits are polled from GitHub API.")
+	fs.DurationVar(&c.CollectionTimeout, "collector.timeout", c.CollectionTimeout, "Timeout of collecting the rate limits of a single credential.")
+	fs.Int64Var(&c.Concurrency, "collector.concurrency", c.Concurrency, "Maximum amount of credentials and installations whose rate limits are collected concurrently.")
+	fs.Int64Var(&c.MaxRetries, "collector.max-retries", c.MaxRetries, "Maximum amount of retries of a failed collection of a single credential. Zero disables retries.")
+	fs.Int64Var(&c.StaleIntervals, "collector.stale-intervals", c.StaleIntervals, "For how many intervals the last known rate limits of a credential are reported after its collection has failed. Zero drops them right away.")
+	fs.DurationVar(&c.InstallationInterval, "collector.installation-interval", c.InstallationInterval, "How often the installations of GitHub Apps are refreshed.")
+	fs.StringVar(&c.ListenAddress, "web.listen-address", c.ListenAddress, "Address to expose the metrics on.")
+	fs.StringVar(&c.WebConfigFile, "web.config.file", c.WebConfigFile, "Path of the web configuration file which enables TLS or authentication.")
+	fs.StringVar(&c.LogLevel, "log.level", c.LogLevel, "Only log messages with the given severity or above. One of: debug, info, warn, error.")
+	fs.StringVar(&c.LogFormat, "log.format", c.LogFormat, "Output format of the logs. One of: json, console.")
+	fs.StringVar(&c.MetricNamespace, "metrics.namespace", c.MetricNamespace, "Namespace of the exported rate limit metrics.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(out, "Usage of %v:\n\n", Name)
+		fmt.Fprintf(out, "Exports GitHub API rate limits as Prometheus metrics.\n\nFlags:\n")
+		fs.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(out, "  --%v\n    \t%v", f.Name, f.Usage)
+			if f.DefValue != "" && f.DefValue != "false" {
+				fmt.Fprintf(out, " (default %q)", f.DefValue)
+			}
+			fmt.Fprintln(out)
+			if !noEnv[f.Name] {
+				fmt.Fprintf(out, "    \tenv: %v\n", envName(f.Name))
+			}
+		})
+	}
+
+	return fs
+}
+
+// noEnv are the flags which cannot be set with environment variables.
+// The version flag is not a setting, and e.g. GHRLE_VERSION is commonly
+// set by container images to the version of the image.
+var noEnv = map[string]bool{"version": true}
+
+// envName returns the environment variable name of the flag,
+// e.g. web.listen-address becomes GHRLE_WEB_LISTEN_ADDRESS.
+func envName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flag))
+}
+
+// Load reads the configuration. flag.ErrHelp is returned if
+// the usage was requested with -h or --help and printed to out.
+func Load(args []string, lookupEnv func(string) (string, bool), out io.Writer) (*Config, error) {
+	// Look up the configuration file first as the
+	// flags and env variables take precedence over it.
+	first := Default()
+	if err := first.flagSet(out).Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	fs := cfg.flagSet(out)
+
+	path := first.ConfigFile
+	if path == "" {
+		path, _ = lookupEnv(envName("config.file"))
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		// Unknown keys are most likely typos, which would otherwise
+		// silently leave the setting at its default.
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("config file %v: %w", path, err)
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		// The configuration file has been looked up already.
+		if noEnv[f.Name] || f.Name == "config.file" {
+			return
+		}
+
+		if v, ok := lookupEnv(envName(f.Name)); ok && err == nil {
+			if serr := fs.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("env %v: %w", envName(f.Name), serr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", strings.Join(fs.Args(), " "))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+var namespaceRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (c *Config) Validate() error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("collector interval must be positive: %v", c.Interval)
+	}
+
+	if c.CollectionTimeout <= 0 {
+		return fmt.Errorf("collector timeout must be positive: %v", c.CollectionTimeout)
+	}
+
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("collector concurrency must be positive: %v", c.Concurrency)
+	}
+
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("collector max retries must not be negative: %v", c.MaxRetries)
+	}
+
+	if c.StaleIntervals < 0 {
+		return fmt.Errorf("collector stale intervals must not be negative: %v", c.StaleIntervals)
+	}
+
+	if c.InstallationInterval <= 0 {
+		return fmt.Errorf("collector installation interval must be positive: %v", c.InstallationInterval)
+	}
+
+	if c.CredentialsReloadInterval < 0 {
+		return fmt.Errorf("credentials reload interval must not be negative: %v", c.CredentialsReloadInterval)
+	}
+
+	if _, err := zap.ParseAtomicLevel(c.LogLevel); err != nil {
+		return err
+	}
+
+	switch logger.Format(c.LogFormat) {
+	case logger.FormatJSON, logger.FormatConsole:
+	default:
+		return fmt.Errorf("unknown log format: %q", c.LogFormat)
+	}
+
+	if !namespaceRegexp.MatchString(c.MetricNamespace) {
+		return fmt.Errorf("invalid metric namespace: %q", c.MetricNamespace)
+	}
+
+	switch c.CredentialsSource {
+	case SourceFile:
+		if c.CredentialsFile == "" {
+			return errors.New("credentials file must be set")
+		}
+	case SourceEnv:
+	case SourceKubernetes:
+		if c.KubernetesSelector == "" {
+			return errors.New("kubernetes selector must be set")
+		}
+	case SourceVault:
+		if c.VaultPath == "" {
+			return errors.New("vault path must be set")
+		}
+		if c.VaultRefreshInterval <= 0 {
+			return fmt.Errorf("vault refresh interval must be positive: %v", c.VaultRefreshInterval)
+		}
+	default:
+		return fmt.Errorf("unknown credentials source: %q", c.CredentialsSource)
+	}
+
+	return nil
+}
+
+// Module replaces the defaults supplied by the exporter modules.
+func (c *Config) Module() fx.Option {
+	interval := exporter.Interval(c.Interval)
+	namespace := exporter.Namespace(c.MetricNamespace)
+	stale := exporter.StaleIntervals(c.StaleIntervals)
+	timeout := exporter.CollectionTimeout(c.CollectionTimeout)
+	concurrency := exporter.Concurrency(c.Concurrency)
+	retries := exporter.MaxRetries(c.MaxRetries)
+	installation := exporter.InstallationInterval(c.InstallationInterval)
+	credentials := exporter.CredentialsPath(c.CredentialsFile)
+	reload := exporter.CredentialsReloadInterval(c.CredentialsReloadInterval)
+	address := server.ListenAddress(c.ListenAddress)
+	webConfig := server.WebConfigFile(c.WebConfigFile)
+	level := logger.Level(c.LogLevel)
+	format := logger.Format(c.LogFormat)
+
+	return fx.Options(
+		fx.Replace(&interval, &namespace, &stale, &timeout, &concurrency, &retries, &installation, &credentials, &reload, &address, &webConfig, &level, &format),
+		c.credentialSource(),
+	)
+}
+
+// credentialSource replaces the default file credential source
+// with the configured one.
+func (c *Config) credentialSource() fx.Option {
+	switch c.CredentialsSource {
+	case SourceEnv:
+		return fx.Decorate(func(fs *afero.Afero) (exporter.CredentialSource, error) {
+			return exporter.NewEnvCredentialSource(os.Environ(), fs)
+		})
+	case SourceKubernetes:
+		return fx.Decorate(func(log logger.Logger) (exporter.CredentialSource, error) {
+			client, err := exporter.NewKubernetesClient(c.KubernetesKubeconfig)
+			if err != nil {
+				return nil, err
+			}
+
+			namespace := c.KubernetesNamespace
+			if namespace == "" {
+				namespace = exporter.InClusterNamespace()
+			}
+
+			return exporter.NewKubernetesCredentialSource(client, namespace, c.KubernetesSelector, log)
+		})
+	case SourceVault:
+		return fx.Decorate(func(log logger.Logger) (exporter.CredentialSource, error) {
+			cfg, err := c.vaultConfig()
+			if err != nil {
+				return nil, err
+			}
+
+			return exporter.NewVaultCredentialSource(cfg, log)
+		})
+	default:
+		return fx.Options()
+	}
+}
+
+func VersionString() string {
+	return fmt.Sprintf("%v version %v (%v %v/%v)", Name, Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+func (c *Config) vaultConfig() (exporter.VaultConfig, error) {
+	cfg := exporter.VaultConfig{
+		Address:         c.VaultAddress,
+		Mount:           c.VaultMount,
+		Path:            c.VaultPath,
+		Auth:            c.VaultAuth,
+		AuthMount:       c.VaultAuthMount,
+		RoleID:          c.VaultRoleID,
+		SecretIDFile:    c.VaultSecretIDFile,
+		Role:            c.VaultRole,
+		JWTFile:         c.VaultJWTFile,
+		RefreshInterval: c.VaultRefreshInterval,
+	}
+
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+
+	var err error
+	if c.VaultAuth == exporter.VaultAuthToken {
+		cfg.Token = os.Getenv("VAULT_TOKEN")
+		if c.VaultTokenFile != "" {
+			cfg.Token, err = readSecretFile(c.VaultTokenFile)
+		}
+	}
+
+	return cfg, err
+}
+
+func readSecretFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
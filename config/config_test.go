@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns defaults without flags, env or config file", func(t *testing.T) {
+		cfg, err := Load(nil, env(nil), io.Discard)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Default(), *cfg)
+	})
+
+	t.Run("reads flags", func(t *testing.T) {
+		cfg, err := Load([]string{
+			"--credentials.file", "/etc/ghrle/credentials.yml",
+			"--collector.interval", "1m",
+			"--web.listen-address", ":9100",
+			"--web.config.file", "/etc/ghrle/web.yml",
+			"--log.level", "debug",
+			"--metrics.namespace", "ghrle",
+		}, env(nil), io.Discard)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "/etc/ghrle/credentials.yml", cfg.CredentialsFile)
+		assert.Equal(t, time.Minute, cfg.Interval)
+		assert.Equal(t, ":9100", cfg.ListenAddress)
+		assert.Equal(t, "/etc/ghrle/web.yml", cfg.WebConfigFile)
+		assert.Equal(t, "debug", cfg.LogLevel)
+		assert.Equal(t, "ghrle", cfg.MetricNamespace)
+	})
+
+	t.Run("reads metrics namespace from config file", func(t *testing.T) {
+		path := writeConfigFile(t, "metrics_namespace: ghrle\n")
+
+		cfg, err := Load([]string{"--config.file", path}, env(nil), io.Discard)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ghrle", cfg.MetricNamespace)
+	})
+
+	t.Run("returns error with unknown key in config file", func(t *testing.T) {
+		path := writeConfigFile(t, "metric_namespace: ghrle\n")
+
+		_, err := Load([]string{"--config.file", path}, env(nil), io.Discard)
+
+		assert.ErrorContains(t, err, "field metric_namespace not found")
+	})
+
+	t.Run("reads empty config file", func(t *testing.T) {
+		path := writeConfigFile(t, "")
+
+		cfg, err := Load([]string{"--config.file", path}, env(nil), io.Discard)
+
+		if assert.NoError(t, err) {
+			cfg.ConfigFile = ""
+			assert.Equal(t, Default(), *cfg)
+		}
+	})
+
+	t.Run("flags take precedence over env and env over config file", func(t *testing.T) {
+		path := writeConfigFile(t, "interval: 10s\nlisten_address: :9000\nlog_level: warn\n")
+
+		cfg, err := Load(
+			[]string{"--log.level", "error"},
+			env(map[string]string{
+				"GHRLE_CONFIG_FILE":        path,
+				"GHRLE_WEB_LISTEN_ADDRESS": ":9001",
+				"GHRLE_LOG_LEVEL":          "debug",
+			}),
+			io.Discard,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 10*time.Second, cfg.Interval)
+		assert.Equal(t, ":9001", cfg.ListenAddress)
+		assert.Equal(t, "error", cfg.LogLevel)
+	})
+
+	t.Run("returns error with invalid env value", func(t *testing.T) {
+		_, err := Load(nil, env(map[string]string{"GHRLE_COLLECTOR_INTERVAL": "often"}), io.Discard)
+
+		assert.ErrorContains(t, err, "env GHRLE_COLLECTOR_INTERVAL")
+	})
+
+	t.Run("ignores env of version and config file flags", func(t *testing.T) {
+		path := writeConfigFile(t, "log_level: warn\n")
+
+		for _, v := range []string{"1.2.3", "true"} {
+			cfg, err := Load(
+				[]string{"--config.file", path},
+				env(map[string]string{"GHRLE_VERSION": v, "GHRLE_CONFIG_FILE": "/does/not/exist"}),
+				io.Discard,
+			)
+
+			assert.NoError(t, err, v)
+			assert.False(t, cfg.ShowVersion, v)
+			assert.Equal(t, path, cfg.ConfigFile, v)
+			assert.Equal(t, "warn", cfg.LogLevel, v)
+		}
+	})
+
+	t.Run("returns error with invalid configuration", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"--collector.interval", "0s"},
+			{"--collector.stale-intervals", "-1"},
+			{"--collector.timeout", "0s"},
+			{"--collector.concurrency", "0"},
+			{"--collector.max-retries", "-1"},
+			{"--collector.installation-interval", "0s"},
+			{"--credentials.reload-interval", "-1s"},
+			{"--log.level", "chatty"},
+			{"--log.format", "xml"},
+			{"--metrics.namespace", "gh-rate-limit"},
+			{"--credentials.file", ""},
+			{"--credentials.source", "unknown"},
+			{"--credentials.source", "vault"},
+			{"--credentials.source", "vault", "--credentials.vault.path", "github/", "--credentials.vault.refresh-interval", "0s"},
+			{"unexpected"},
+		} {
+			_, err := Load(args, env(nil), io.Discard)
+
+			assert.Error(t, err, args)
+		}
+	})
+
+	t.Run("prints usage with env variables on help", func(t *testing.T) {
+		var out bytes.Buffer
+		_, err := Load([]string{"--help"}, env(nil), &out)
+
+		assert.ErrorIs(t, err, flag.ErrHelp)
+		assert.Contains(t, out.String(), "--web.listen-address")
+		assert.Contains(t, out.String(), "GHRLE_WEB_LISTEN_ADDRESS")
+		assert.NotContains(t, out.String(), "GHRLE_VERSION")
+	})
+
+	t.Run("reads version flag", func(t *testing.T) {
+		cfg, err := Load([]string{"--version"}, env(nil), io.Discard)
+
+		assert.NoError(t, err)
+		assert.True(t, cfg.ShowVersion)
+		assert.Contains(t, VersionString(), Version)
+	})
+}
@@ -1,8 +1,11 @@
 package logger
 
 import (
+	"fmt"
+
 	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type Logger interface {
@@ -12,10 +15,46 @@ type Logger interface {
 	Info(args ...any)
 	Warn(args ...any)
 	Error(args ...any)
+
+	// Debugw, Infow, Warnw and Errorw log the message
+	// with the key-value pairs as structured fields.
+	Debugw(msg string, keysAndValues ...any)
+	Infow(msg string, keysAndValues ...any)
+	Warnw(msg string, keysAndValues ...any)
+	Errorw(msg string, keysAndValues ...any)
 }
 
-func NewLogger() (Logger, error) {
-	logger, err := zap.NewProduction()
+// Level is the minimum enabled logging level, e.g. "debug" or "info".
+type Level string
+
+// Format is the output format of the logs.
+type Format string
+
+const (
+	FormatJSON    Format = "json"
+	FormatConsole Format = "console"
+)
+
+func NewLogger(level *Level, format *Format) (Logger, error) {
+	lvl, err := zap.ParseAtomicLevel(string(*level))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = lvl
+
+	switch *format {
+	case FormatJSON:
+	case FormatConsole:
+		cfg.Encoding = string(FormatConsole)
+		cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		cfg.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	default:
+		return nil, fmt.Errorf("unknown log format: %q", *format)
+	}
+
+	logger, err := cfg.Build()
 	if err != nil {
 		return nil, err
 	}
@@ -24,7 +63,13 @@ func NewLogger() (Logger, error) {
 }
 
 func Module() fx.Option {
-	return fx.Provide(NewLogger)
+	level := Level("info")
+	format := FormatJSON
+
+	return fx.Options(
+		fx.Supply(&level, &format),
+		fx.Provide(NewLogger),
+	)
 }
 
 type NopLogger struct{}
@@ -41,4 +86,12 @@ func (*NopLogger) Warn(args ...any) {}
 
 func (*NopLogger) Error(args ...any) {}
 
+func (*NopLogger) Debugw(msg string, keysAndValues ...any) {}
+
+func (*NopLogger) Infow(msg string, keysAndValues ...any) {}
+
+func (*NopLogger) Warnw(msg string, keysAndValues ...any) {}
+
+func (*NopLogger) Errorw(msg string, keysAndValues ...any) {}
+
 var _ Logger = (*NopLogger)(nil)
@@ -0,0 +1,36 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	level := Level("debug")
+
+	for _, format := range []Format{FormatJSON, FormatConsole} {
+		format := format
+		log, err := NewLogger(&level, &format)
+
+		assert.NoError(t, err, format)
+		assert.NotNil(t, log, format)
+	}
+
+	t.Run("rejects unknown format", func(t *testing.T) {
+		format := Format("xml")
+
+		_, err := NewLogger(&level, &format)
+
+		assert.EqualError(t, err, `unknown log format: "xml"`)
+	})
+
+	t.Run("rejects unknown level", func(t *testing.T) {
+		level := Level("chatty")
+		format := FormatJSON
+
+		_, err := NewLogger(&level, &format)
+
+		assert.Error(t, err)
+	})
+}
@@ -1,6 +1,12 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/config"
 	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
 	"github.com/ragnarpa/gh-rate-limit-exporter/metrics"
 	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/exporter"
@@ -19,5 +25,19 @@ func module() fx.Option {
 }
 
 func main() {
-	fx.New(module()).Run()
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if cfg.ShowVersion {
+		fmt.Println(config.VersionString())
+		return
+	}
+
+	fx.New(module(), cfg.Module()).Run()
 }
@@ -13,6 +13,7 @@ import (
 
 	prommodel "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
+	"github.com/ragnarpa/gh-rate-limit-exporter/config"
 	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
 	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/exporter"
 	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/github"
@@ -45,14 +46,18 @@ func (*roundTripperMock) RoundTrip(req *http.Request) (*http.Response, error) {
 	return r, nil
 }
 
-var httpClientMock *http.Client = &http.Client{Transport: &roundTripperMock{}}
+// newHttpClientMock returns a new client every time
+// because the clients are instrumented concurrently.
+func newHttpClientMock() *http.Client {
+	return &http.Client{Transport: &roundTripperMock{}}
+}
 
 func newHttpClientWithApp(github.App) (*http.Client, error) {
-	return httpClientMock, nil
+	return newHttpClientMock(), nil
 }
 
 func newHttpClientWithPAT(context.Context, github.PAT) *http.Client {
-	return httpClientMock
+	return newHttpClientMock()
 }
 
 //go:embed testdata/test-credentials.yml
@@ -76,6 +81,7 @@ func sut(ctx context.Context, t *testing.T) *fx.App {
 		fx.Replace(fx.Annotate(&logger.NopLogger{}, fx.As(new(logger.Logger)))),
 		fx.Decorate(func() exporter.HttpClientWithAppFactory { return newHttpClientWithApp }),
 		fx.Decorate(func() exporter.HttpClientWithPATFactory { return newHttpClientWithPAT }),
+		fx.Decorate(func() exporter.HttpClientWithAppJWTFactory { return newHttpClientWithApp }),
 	)
 
 	if err := app.Start(ctx); err != nil {
@@ -109,6 +115,76 @@ func TestModule(t *testing.T) {
 		app.RequireStart().RequireStop()
 	})
 
+	t.Run("fx app starts with configuration", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		fs.WriteFile("/etc/ghrle/credentials.yml", []byte(""), 0600)
+
+		cfg, err := config.Load(
+			[]string{"--credentials.file", "/etc/ghrle/credentials.yml", "--web.listen-address", "localhost:0"},
+			func(string) (string, bool) { return "", false },
+			io.Discard,
+		)
+		if err != nil {
+			fatal(t, err)
+		}
+
+		app := fxtest.New(
+			t,
+			module(),
+			cfg.Module(),
+			fx.Replace(&fs),
+			fx.Replace(fx.Annotate(&logger.NopLogger{}, fx.As(new(logger.Logger)))),
+		)
+
+		app.RequireStart().RequireStop()
+	})
+
+	t.Run("fx app starts with env credential source", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+		cfg, err := config.Load(
+			[]string{"--credentials.source", "env", "--web.listen-address", "localhost:0"},
+			func(string) (string, bool) { return "", false },
+			io.Discard,
+		)
+		if err != nil {
+			fatal(t, err)
+		}
+
+		app := fxtest.New(
+			t,
+			module(),
+			cfg.Module(),
+			fx.Replace(&fs),
+			fx.Replace(fx.Annotate(&logger.NopLogger{}, fx.As(new(logger.Logger)))),
+		)
+
+		app.RequireStart().RequireStop()
+	})
+
+	t.Run("fx app serves health and readiness", func(t *testing.T) {
+		ctx := context.Background()
+		app := sut(ctx, t)
+		defer app.Stop(ctx)
+
+		resp, err := http.Get("http://localhost:" + server.Port + "/healthz")
+		if err != nil {
+			fatal(t, err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Eventually(t, func() bool {
+			resp, err := http.Get("http://localhost:" + server.Port + "/readyz")
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+
+			return resp.StatusCode == http.StatusOK
+		}, time.Second, 10*time.Millisecond)
+	})
+
 	for _, test := range []struct {
 		resource string
 		metric   string
@@ -0,0 +1,74 @@
+package exporter
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// clientCache keeps one RateLimitsService per credential for the lifetime
+// of the collector. This way authenticated HTTP clients and GitHub App
+// installation tokens are reused across collections instead of being
+// recreated on every polling round.
+type clientCache struct {
+	factory RateLimitsServiceFactory
+	mtx     sync.Mutex
+	entries map[string]*clientCacheEntry
+}
+
+type clientCacheEntry struct {
+	credential *Credential
+	service    RateLimitsService
+}
+
+func newClientCache(f RateLimitsServiceFactory) *clientCache {
+	return &clientCache{factory: f, entries: make(map[string]*clientCacheEntry)}
+}
+
+// Get returns the cached service for the credential. A new service is
+// created if there is none yet or if the credential has changed since
+// the cached one was created.
+func (cc *clientCache) Get(ctx context.Context, c *Credential) (RateLimitsService, error) {
+	cc.mtx.Lock()
+	defer cc.mtx.Unlock()
+
+	if e, ok := cc.entries[c.AppName]; ok && reflect.DeepEqual(e.credential, c) {
+		return e.service, nil
+	}
+
+	s, err := cc.factory.Create(ctx, c)
+	if err != nil {
+		delete(cc.entries, c.AppName)
+		return nil, err
+	}
+
+	cc.entries[c.AppName] = &clientCacheEntry{credential: c.clone(), service: s}
+
+	return s, nil
+}
+
+// Invalidate drops the cached service for the credential with given name.
+func (cc *clientCache) Invalidate(name string) {
+	cc.mtx.Lock()
+	defer cc.mtx.Unlock()
+
+	delete(cc.entries, name)
+}
+
+// Retain drops the cached services of all credentials
+// which are not present in given credentials.
+func (cc *clientCache) Retain(credentials []*Credential) {
+	names := make(map[string]struct{}, len(credentials))
+	for _, c := range credentials {
+		names[c.AppName] = struct{}{}
+	}
+
+	cc.mtx.Lock()
+	defer cc.mtx.Unlock()
+
+	for name := range cc.entries {
+		if _, ok := names[name]; !ok {
+			delete(cc.entries, name)
+		}
+	}
+}
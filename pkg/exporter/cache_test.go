@@ -0,0 +1,89 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingFactoryMock struct {
+	created int
+	err     error
+}
+
+func (f *countingFactoryMock) Create(context.Context, *Credential) (RateLimitsService, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.created++
+
+	return &rateLimitsServiceMock{}, nil
+}
+
+func TestClientCache(t *testing.T) {
+	t.Parallel()
+
+	newCredential := func(token string) *Credential {
+		return &Credential{Type: GitHubPAT, AppName: "test-app", PAT: &PAT{Token: Secret(token)}}
+	}
+
+	t.Run("reuses service for unchanged credential", func(t *testing.T) {
+		f := &countingFactoryMock{}
+		cc := newClientCache(f)
+
+		s1, err1 := cc.Get(context.Background(), newCredential("token"))
+		s2, err2 := cc.Get(context.Background(), newCredential("token"))
+
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.Same(t, s1, s2)
+		assert.Equal(t, 1, f.created)
+	})
+
+	t.Run("recreates service for changed credential", func(t *testing.T) {
+		f := &countingFactoryMock{}
+		cc := newClientCache(f)
+		c := newCredential("token")
+
+		s1, _ := cc.Get(context.Background(), c)
+		c.PAT.Token = "rotated"
+		s2, _ := cc.Get(context.Background(), c)
+
+		assert.NotSame(t, s1, s2)
+		assert.Equal(t, 2, f.created)
+	})
+
+	t.Run("recreates service after invalidation", func(t *testing.T) {
+		f := &countingFactoryMock{}
+		cc := newClientCache(f)
+
+		cc.Get(context.Background(), newCredential("token"))
+		cc.Invalidate("test-app")
+		cc.Get(context.Background(), newCredential("token"))
+
+		assert.Equal(t, 2, f.created)
+	})
+
+	t.Run("drops services of removed credentials", func(t *testing.T) {
+		f := &countingFactoryMock{}
+		cc := newClientCache(f)
+
+		cc.Get(context.Background(), newCredential("token"))
+		cc.Retain(nil)
+
+		assert.Empty(t, cc.entries)
+	})
+
+	t.Run("does not cache failures", func(t *testing.T) {
+		f := &countingFactoryMock{err: errors.New("boom")}
+		cc := newClientCache(f)
+
+		s, err := cc.Get(context.Background(), newCredential("token"))
+
+		assert.Nil(t, s)
+		assert.EqualError(t, err, "boom")
+		assert.Empty(t, cc.entries)
+	})
+}
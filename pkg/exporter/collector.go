@@ -2,9 +2,16 @@ package exporter
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
@@ -21,6 +28,12 @@ type (
 		RateLimits(context.Context) ([]*github.RateLimit, error)
 	}
 
+	// InstallationService is implemented by the
+	// RateLimitsService of GitHub App credentials.
+	InstallationService interface {
+		Installations(context.Context) ([]*github.Installation, error)
+	}
+
 	RateLimitsServiceFactory interface {
 		Create(context.Context, *Credential) (RateLimitsService, error)
 	}
@@ -29,33 +42,86 @@ type (
 type (
 	HttpClientWithPATFactory func(context.Context, github.PAT) *http.Client
 	HttpClientWithAppFactory func(github.App) (*http.Client, error)
+	// HttpClientWithAppJWTFactory creates clients which
+	// authenticate as the GitHub App itself.
+	HttpClientWithAppJWTFactory func(github.App) (*http.Client, error)
 
 	RateLimitsServiceFactoryParams struct {
 		fx.In
 
-		Instrumenter             Instrumenter
-		HttpClientWithPATFactory HttpClientWithPATFactory
-		HttpClientWithAppFactory HttpClientWithAppFactory
+		Instrumenter                Instrumenter
+		HttpClientWithPATFactory    HttpClientWithPATFactory
+		HttpClientWithAppFactory    HttpClientWithAppFactory
+		HttpClientWithAppJWTFactory HttpClientWithAppJWTFactory `optional:"true"`
+		// Installation is how often the installations
+		// of GitHub Apps are listed.
+		Installation *InstallationInterval `optional:"true"`
+		// Limiter, or a limiter of Concurrency if it is not set, and
+		// MaxRetries apply to the installations of a GitHub App
+		// whose installations are discovered.
+		Limiter     *Limiter      `optional:"true"`
+		Concurrency *Concurrency  `optional:"true"`
+		MaxRetries  *MaxRetries   `optional:"true"`
+		Log         logger.Logger `optional:"true"`
 	}
 
 	rateLimitsServiceFactory struct {
-		instrumenter            Instrumenter
-		createHTTPClientWithPAT func(context.Context, github.PAT) *http.Client
-		createHTTPClientWithApp func(github.App) (*http.Client, error)
+		instrumenter               Instrumenter
+		createHTTPClientWithPAT    func(context.Context, github.PAT) *http.Client
+		createHTTPClientWithApp    func(github.App) (*http.Client, error)
+		createHTTPClientWithAppJWT func(github.App) (*http.Client, error)
+		installationInterval       time.Duration
+		limiter                    *Limiter
+		retry                      github.RetryPolicy
+		log                        logger.Logger
 	}
 )
 
 func NewRateLimitsServiceFactory(p RateLimitsServiceFactoryParams) RateLimitsServiceFactory {
+	installationInterval := DefaultInstallationInterval
+	if p.Installation != nil && *p.Installation > 0 {
+		installationInterval = time.Duration(*p.Installation)
+	}
+
+	limiter := p.Limiter
+	if limiter == nil {
+		limiter = NewLimiter(p.Concurrency)
+	}
+
+	var log logger.Logger = &logger.NopLogger{}
+	if p.Log != nil {
+		log = p.Log
+	}
+
 	return &rateLimitsServiceFactory{
-		instrumenter:            p.Instrumenter,
-		createHTTPClientWithPAT: p.HttpClientWithPATFactory,
-		createHTTPClientWithApp: p.HttpClientWithAppFactory,
+		instrumenter:               p.Instrumenter,
+		createHTTPClientWithPAT:    p.HttpClientWithPATFactory,
+		createHTTPClientWithApp:    p.HttpClientWithAppFactory,
+		createHTTPClientWithAppJWT: p.HttpClientWithAppJWTFactory,
+		installationInterval:       installationInterval,
+		limiter:                    limiter,
+		retry:                      retryPolicy(p.MaxRetries),
+		log:                        log,
 	}
 }
 
+// retryPolicy returns the policy of retrying failed collections.
+func retryPolicy(maxRetries *MaxRetries) github.RetryPolicy {
+	retries := DefaultMaxRetries
+	if maxRetries != nil && *maxRetries >= 0 {
+		retries = int(*maxRetries)
+	}
+
+	return github.RetryPolicy{MaxRetries: retries, MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+}
+
 func (f *rateLimitsServiceFactory) Create(ctx context.Context, c *Credential) (RateLimitsService, error) {
 	switch c.Type {
 	case GitHubApp:
+		if c.DiscoversInstallations() {
+			return f.newInstallationsService(c)
+		}
+
 		client, err := f.createHTTPClientWithApp(c)
 		if err != nil {
 			return nil, err
@@ -63,12 +129,22 @@ func (f *rateLimitsServiceFactory) Create(ctx context.Context, c *Credential) (R
 
 		f.instrumenter.Instrument(client)
 
-		return github.NewGitHubClientForApp(c, client), nil
+		var appClient *http.Client
+		if f.createHTTPClientWithAppJWT != nil {
+			appClient, err = f.createHTTPClientWithAppJWT(c)
+			if err != nil {
+				return nil, err
+			}
+
+			f.instrumenter.Instrument(appClient)
+		}
+
+		return github.NewGitHubClientForApp(c, client, appClient)
 	case GitHubPAT:
 		base := f.createHTTPClientWithPAT(ctx, c)
 		f.instrumenter.Instrument(base)
 
-		return github.NewGitHubClientForPAT(c, base), nil
+		return github.NewGitHubClientForPAT(c, base)
 	default:
 		return nil, fmt.Errorf("unknown kind: %v", c.Type)
 	}
@@ -80,38 +156,156 @@ const (
 	LabelType              = "type"
 	LabelAppID             = "app_id"
 	LabelAppInstallationID = "app_installation_id"
+	LabelAPIHost           = "api_host"
+	LabelClass             = "class"
+	LabelTokenKind         = "token_kind"
+	LabelScopes            = "scopes"
+	LabelOwner             = "owner"
+	LabelAccount           = "account"
+	LabelAccountType       = "account_type"
+	LabelRepoSelection     = "repository_selection"
+	LabelPermissions       = "permissions"
+)
+
+// DefaultNamespace is the default namespace of the exported metrics.
+const DefaultNamespace = "gh_rate_limit_exporter"
+
+const (
+	// DefaultCollectionTimeout is the default timeout of
+	// collecting the rate limits of a single credential.
+	DefaultCollectionTimeout = 10 * time.Second
+	// DefaultConcurrency is the default maximum amount of credentials
+	// and installations whose rate limits are collected concurrently.
+	DefaultConcurrency = 10
+	// DefaultMaxRetries is the default maximum amount of retries
+	// of a failed collection of a single credential.
+	DefaultMaxRetries = 2
+	// DefaultInstallationInterval is the default interval
+	// of refreshing the installations of GitHub Apps.
+	DefaultInstallationInterval = time.Hour
 )
 
 type (
 	Interval int64
 
+	// Namespace is the namespace (prefix) of the exported metrics.
+	Namespace string
+
+	// CollectionTimeout is the timeout of collecting
+	// the rate limits of a single credential.
+	CollectionTimeout int64
+
+	// Concurrency is the maximum amount of credentials and
+	// installations whose rate limits are collected concurrently.
+	Concurrency int64
+
+	// MaxRetries is the maximum amount of retries
+	// of a failed collection of a single credential.
+	MaxRetries int64
+
+	// StaleIntervals is for how many intervals the last known rate limits
+	// of a credential are reported after its collection has failed. Zero
+	// drops the rate limits of a credential as soon as its collection fails.
+	StaleIntervals int64
+
+	// InstallationInterval is how often the installations
+	// of GitHub Apps are refreshed.
+	InstallationInterval int64
+
 	CollectorParams struct {
 		fx.In
 
 		Interval     *Interval
+		Namespace    *Namespace            `optional:"true"`
+		Stale        *StaleIntervals       `optional:"true"`
+		Timeout      *CollectionTimeout    `optional:"true"`
+		Concurrency  *Concurrency          `optional:"true"`
+		MaxRetries   *MaxRetries           `optional:"true"`
+		Installation *InstallationInterval `optional:"true"`
 		Credentials  []*Credential
 		Instrumenter Instrumenter
 		Factory      RateLimitsServiceFactory
 		Log          logger.Logger
+		// Limiter is shared with the factory, so the installations of
+		// GitHub Apps count against the concurrency as well. A limiter
+		// of Concurrency is used if it is not set.
+		Limiter *Limiter `optional:"true"`
+	}
+
+	// collectionStatus is the outcome of the last
+	// collection of the rate limits of a credential.
+	collectionStatus struct {
+		kind           string
+		success        bool
+		duration       time.Duration
+		lastCollection time.Time
+		lastSuccess    time.Time
+		lastError      error
+		// installations are the last read installations of a GitHub App.
+		installations    []*github.Installation
+		installationTime time.Time
+	}
+
+	// collection is the result of collecting
+	// the rate limits of a single credential.
+	collection struct {
+		credential    *Credential
+		limits        []*github.RateLimit
+		installations []*github.Installation
+		err           error
+		start         time.Time
+		duration      time.Duration
 	}
 
 	Collector struct {
-		credentials        []*Credential
-		rateLimitTotal     *prometheus.GaugeVec
-		rateLimitRemaining *prometheus.GaugeVec
-		rateLimitUsage     *prometheus.GaugeVec
-		interval           *Interval
-		factory            RateLimitsServiceFactory
-		log                logger.Logger
-		mtx                sync.Mutex
-		ctx                context.Context
-		cancel             context.CancelFunc
+		credentials          []*Credential
+		rateLimitTotal       *prometheus.GaugeVec
+		rateLimitRemaining   *prometheus.GaugeVec
+		rateLimitUsage       *prometheus.GaugeVec
+		rateLimitUsed        *prometheus.GaugeVec
+		rateLimitReset       *prometheus.GaugeVec
+		secondsUntilReset    *prometheus.GaugeVec
+		consumptionRate      *prometheus.GaugeVec
+		secondsUntilEmpty    *prometheus.GaugeVec
+		rateLimitAge         *prometheus.GaugeVec
+		rateLimitStale       *prometheus.GaugeVec
+		success              *prometheus.GaugeVec
+		duration             *prometheus.GaugeVec
+		lastSuccess          *prometheus.GaugeVec
+		errors               *prometheus.CounterVec
+		retries              *prometheus.CounterVec
+		tokenExpiration      *prometheus.GaugeVec
+		tokenInfo            *prometheus.GaugeVec
+		installationInfo     *prometheus.GaugeVec
+		installationInterval time.Duration
+		params               CollectorParams
+		interval             *Interval
+		stale                StaleIntervals
+		timeout              time.Duration
+		limiter              *Limiter
+		retry                github.RetryPolicy
+		factory              RateLimitsServiceFactory
+		clients              *clientCache
+		log                  logger.Logger
+		mtx                  sync.Mutex
+		limits               []*github.RateLimit
+		consumption          map[string]float64
+		status               map[string]*collectionStatus
+		wg                   sync.WaitGroup
+		started              atomic.Bool
+		ready                chan struct{}
+		readyOnce            sync.Once
+		ctx                  context.Context
+		cancel               context.CancelFunc
 	}
 )
 
 func NewCollector(p CollectorParams) *Collector {
-	const ns = "gh_rate_limit_exporter"
-	labels := []string{LabelName, LabelResource, LabelType, LabelAppID, LabelAppInstallationID}
+	ns := DefaultNamespace
+	if p.Namespace != nil {
+		ns = string(*p.Namespace)
+	}
+	labels := []string{LabelName, LabelResource, LabelType, LabelAppID, LabelAppInstallationID, LabelAPIHost}
 
 	rateLimit := prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -137,53 +331,581 @@ func NewCollector(p CollectorParams) *Collector {
 		},
 		labels,
 	)
+	rateLimitUsed := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "rate_limit_used",
+			Help:      "the amount of requests made within the time unit the rate limit is applied on",
+		},
+		labels,
+	)
+	rateLimitReset := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "rate_limit_reset_timestamp_seconds",
+			Help:      "the time at which the current rate limit window resets in UTC epoch seconds",
+		},
+		labels,
+	)
+	secondsUntilReset := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "rate_limit_seconds_until_reset",
+			Help:      "the amount of seconds until the current rate limit window resets",
+		},
+		labels,
+	)
+	consumptionRate := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "rate_limit_consumption_rate",
+			Help:      "the amount of requests per second made between the last two polls",
+		},
+		labels,
+	)
+	secondsUntilEmpty := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "rate_limit_seconds_until_exhaustion",
+			Help:      "the amount of seconds until the rate limit is exhausted at the current consumption rate, +Inf if no requests are made",
+		},
+		labels,
+	)
+
+	rateLimitAge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "rate_limit_age_seconds",
+			Help:      "the amount of seconds since the rate limit was read from GitHub API",
+		},
+		labels,
+	)
+	rateLimitStale := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "rate_limit_stale",
+			Help:      "whether the rate limit is the last known value reported after a failed collection (1) or up to date (0)",
+		},
+		labels,
+	)
+
+	credentialLabels := []string{LabelName, LabelType}
+	success := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "collection_success",
+			Help:      "whether the last collection of the rate limits of the credential succeeded (1) or failed (0)",
+		},
+		credentialLabels,
+	)
+	duration := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "collection_duration_seconds",
+			Help:      "the duration of the last collection of the rate limits of the credential",
+		},
+		credentialLabels,
+	)
+	lastSuccess := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "the time of the last successful collection of the rate limits of the credential in UTC epoch seconds",
+		},
+		credentialLabels,
+	)
+	collectionErrors := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "collection_errors_total",
+			Help:      "the amount of failed collections of the rate limits of the credential by error class (auth, rate_limited, 5xx, network, other)",
+		},
+		append(credentialLabels, LabelClass),
+	)
+	tokenExpiration := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "token_expiration_timestamp_seconds",
+			Help:      "the expiration time of the personal access token in UTC epoch seconds, absent if the token doesn't expire",
+		},
+		credentialLabels,
+	)
+	tokenInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "token_info",
+			Help:      "the kind (classic or fine-grained), comma separated scopes and owner of the personal access token",
+		},
+		[]string{LabelName, LabelType, LabelTokenKind, LabelScopes, LabelOwner},
+	)
+	installationInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "app_installation_info",
+			Help:      "the account, account type (organization or user), repository selection and comma separated permissions of the GitHub App installation",
+		},
+		[]string{LabelName, LabelAppID, LabelAppInstallationID, LabelAccount, LabelAccountType, LabelRepoSelection, LabelPermissions},
+	)
+
+	var stale StaleIntervals
+	if p.Stale != nil {
+		stale = *p.Stale
+	}
+
+	timeout := DefaultCollectionTimeout
+	if p.Timeout != nil && *p.Timeout > 0 {
+		timeout = time.Duration(*p.Timeout)
+	}
+
+	limiter := p.Limiter
+	if limiter == nil {
+		limiter = NewLimiter(p.Concurrency)
+	}
+
+	retries := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "collection_retries_total",
+			Help:      "the amount of retried collections of the rate limits of the credential by error class (rate_limited, 5xx, network)",
+		},
+		append(credentialLabels, LabelClass),
+	)
+
+	installationInterval := DefaultInstallationInterval
+	if p.Installation != nil && *p.Installation > 0 {
+		installationInterval = time.Duration(*p.Installation)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Collector{
-		interval:           p.Interval,
-		credentials:        p.Credentials,
-		rateLimitTotal:     rateLimit,
-		rateLimitRemaining: rateLimitRemaining,
-		rateLimitUsage:     rateLimitUsage,
-		factory:            p.Factory,
-		log:                p.Log,
-		ctx:                ctx,
-		cancel:             cancel,
+		params:               p,
+		interval:             p.Interval,
+		stale:                stale,
+		timeout:              timeout,
+		limiter:              limiter,
+		retry:                retryPolicy(p.MaxRetries),
+		ready:                make(chan struct{}),
+		credentials:          p.Credentials,
+		rateLimitTotal:       rateLimit,
+		rateLimitRemaining:   rateLimitRemaining,
+		rateLimitUsage:       rateLimitUsage,
+		rateLimitUsed:        rateLimitUsed,
+		rateLimitReset:       rateLimitReset,
+		secondsUntilReset:    secondsUntilReset,
+		consumptionRate:      consumptionRate,
+		secondsUntilEmpty:    secondsUntilEmpty,
+		rateLimitAge:         rateLimitAge,
+		rateLimitStale:       rateLimitStale,
+		success:              success,
+		duration:             duration,
+		lastSuccess:          lastSuccess,
+		errors:               collectionErrors,
+		retries:              retries,
+		tokenExpiration:      tokenExpiration,
+		tokenInfo:            tokenInfo,
+		installationInfo:     installationInfo,
+		installationInterval: installationInterval,
+		status:               make(map[string]*collectionStatus),
+		factory:              p.Factory,
+		clients:              newClientCache(p.Factory),
+		log:                  p.Log,
+		ctx:                  ctx,
+		cancel:               cancel,
+	}
+}
+
+// Start starts polling GitHub API for the rate limits in the background.
+// The rate limits are refreshed once immediately and then every interval.
+func (c *Collector) Start() {
+	c.mtx.Lock()
+	c.warnEmptyTokens(c.credentials, func(string) bool { return true })
+	c.mtx.Unlock()
+
+	c.started.Store(true)
+	c.wg.Add(1)
+	go c.poll()
+}
+
+// Wait waits until the first polling round has completed or the context
+// is done. Wait returns right away if the collector hasn't been started.
+func (c *Collector) Wait(ctx context.Context) error {
+	if !c.started.Load() {
+		return nil
+	}
+
+	select {
+	case <-c.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
+// Ready reports whether the first polling round has completed.
+func (c *Collector) Ready() bool {
+	select {
+	case <-c.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown stops the background polling and waits for it to return.
 func (c *Collector) Shutdown() {
 	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *Collector) poll() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(*c.interval))
+	defer ticker.Stop()
+
+	for {
+		c.refresh(c.ctx)
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Collector) refresh(ctx context.Context) {
+	collections := c.collectAll(ctx)
+
+	// Don't replace the snapshot with a partial
+	// one if the collector was shut down meanwhile.
+	if ctx.Err() != nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var limits []*github.RateLimit
+	for _, col := range collections {
+		c.setStatus(col)
+		if col.err != nil {
+			limits = append(limits, c.staleLimits(col.credential.AppName)...)
+			continue
+		}
+		limits = append(limits, col.limits...)
+	}
+
+	// Credentials may have been removed during the round.
+	limits = retainLimits(limits, c.credentials)
+	c.consumption = consumptionRates(c.limits, limits)
+	c.limits = limits
+
+	c.readyOnce.Do(func() { close(c.ready) })
+}
+
+// staleLimits returns the last known rate limits of the credential
+// if they are not older than the configured amount of intervals.
+func (c *Collector) staleLimits(name string) []*github.RateLimit {
+	st, ok := c.status[name]
+	if c.stale <= 0 || !ok || st.lastSuccess.IsZero() {
+		return nil
+	}
+
+	if time.Since(st.lastSuccess) > time.Duration(c.stale)*time.Duration(*c.interval) {
+		return nil
+	}
+
+	var limits []*github.RateLimit
+	for _, rl := range c.limits {
+		if rl.AppName == name {
+			limits = append(limits, rl)
+		}
+	}
+
+	return limits
+}
+
+func (c *Collector) setStatus(col *collection) {
+	name := col.credential.AppName
+	if !hasCredential(c.credentials, name) {
+		return
+	}
+
+	st, ok := c.status[name]
+	if !ok {
+		st = &collectionStatus{}
+		c.status[name] = st
+	}
+
+	st.kind = col.credential.Kind()
+	st.success = col.err == nil
+	st.duration = col.duration
+	st.lastCollection = col.start.Add(col.duration)
+	st.lastError = col.err
+	if col.installations != nil {
+		st.installations = col.installations
+		st.installationTime = st.lastCollection
+	}
+	if col.err == nil {
+		st.lastSuccess = st.lastCollection
+		return
+	}
+
+	c.errors.WithLabelValues(name, st.kind, github.ErrorClass(col.err)).Inc()
+}
+
+func hasCredential(credentials []*Credential, name string) bool {
+	for _, c := range credentials {
+		if c.AppName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// consumptionRates returns the requests per second made between
+// the previous and the current rate limits, keyed by series.
+func consumptionRates(prev, cur []*github.RateLimit) map[string]float64 {
+	last := make(map[string]*github.RateLimit, len(prev))
+	for _, rl := range prev {
+		last[seriesKey(rl)] = rl
+	}
+
+	rates := make(map[string]float64, len(cur))
+	for _, rl := range cur {
+		key := seriesKey(rl)
+		p, ok := last[key]
+		if !ok || p.Time.IsZero() {
+			continue
+		}
+
+		elapsed := rl.Time.Sub(p.Time).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+
+		used := rl.Used - p.Used
+		if !rl.Reset.Equal(p.Reset) || used < 0 {
+			// The window was reset after the previous poll, so all
+			// requests of the current window were made since then.
+			used = rl.Used
+		}
+
+		rates[key] = float64(used) / elapsed
+	}
+
+	return rates
+}
+
+func seriesKey(rl *github.RateLimit) string {
+	return strings.Join(labels(rl), "\xff")
+}
+
+// SetCredentials atomically replaces the credentials the rate limits are
+// collected for. The series of removed credentials are dropped right away.
+func (c *Collector) SetCredentials(credentials []*Credential) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	added, removed, changed := diffCredentials(c.credentials, credentials)
+	c.credentials = credentials
+	c.limits = retainLimits(c.limits, credentials)
+	c.clients.Retain(credentials)
+	for _, name := range changed {
+		// The installation may have changed along with the credential.
+		if st, ok := c.status[name]; ok {
+			st.installations = nil
+		}
+	}
+	for _, name := range removed {
+		delete(c.status, name)
+		c.errors.DeletePartialMatch(prometheus.Labels{LabelName: name})
+		c.retries.DeletePartialMatch(prometheus.Labels{LabelName: name})
+	}
+
+	if len(added)+len(removed)+len(changed) > 0 {
+		c.log.Infow("credentials updated", "added", added, "removed", removed, "changed", changed)
+	}
+
+	updated := make(map[string]bool, len(added)+len(changed))
+	for _, name := range append(added, changed...) {
+		updated[name] = true
+	}
+	c.warnEmptyTokens(credentials, func(name string) bool { return updated[name] })
+}
+
+// warnEmptyTokens warns about the personal access token
+// credentials without a token which match the filter.
+func (c *Collector) warnEmptyTokens(credentials []*Credential, filter func(name string) bool) {
+	for _, credential := range credentials {
+		if credential.Type != GitHubPAT || credential.Token() != "" || !filter(credential.AppName) {
+			continue
+		}
+
+		c.log.Warnw("credential has an empty token, sending its requests without authentication", "credential", credential.AppName)
+	}
+}
+
+func retainLimits(limits []*github.RateLimit, credentials []*Credential) []*github.RateLimit {
+	names := make(map[string]struct{}, len(credentials))
+	for _, c := range credentials {
+		names[c.AppName] = struct{}{}
+	}
+
+	var res []*github.RateLimit
+	for _, rl := range limits {
+		if _, ok := names[rl.AppName]; ok {
+			res = append(res, rl)
+		}
+	}
+
+	return res
+}
+
+func diffCredentials(old, cur []*Credential) (added, removed, changed []string) {
+	prev := make(map[string]*Credential, len(old))
+	for _, c := range old {
+		prev[c.AppName] = c
+	}
+
+	for _, c := range cur {
+		p, ok := prev[c.AppName]
+		switch {
+		case !ok:
+			added = append(added, c.AppName)
+		case !reflect.DeepEqual(p, c):
+			changed = append(changed, c.AppName)
+		}
+		delete(prev, c.AppName)
+	}
+
+	for name := range prev {
+		removed = append(removed, name)
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+
+	return added, removed, changed
 }
 
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.rateLimitTotal.Describe(ch)
 	c.rateLimitRemaining.Describe(ch)
 	c.rateLimitUsage.Describe(ch)
+	c.rateLimitUsed.Describe(ch)
+	c.rateLimitReset.Describe(ch)
+	c.secondsUntilReset.Describe(ch)
+	c.consumptionRate.Describe(ch)
+	c.secondsUntilEmpty.Describe(ch)
+	c.rateLimitAge.Describe(ch)
+	c.rateLimitStale.Describe(ch)
+	c.success.Describe(ch)
+	c.duration.Describe(ch)
+	c.lastSuccess.Describe(ch)
+	c.errors.Describe(ch)
+	c.retries.Describe(ch)
+	c.tokenExpiration.Describe(ch)
+	c.tokenInfo.Describe(ch)
+	c.installationInfo.Describe(ch)
 }
 
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	// Reset the metrics. If metrics collection
-	// should fail then we don't report possibly stale values.
+	// Reset the metrics and report only the rate limits of the
+	// last polling round. If collection for a credential failed
+	// then we don't report possibly stale values, unless
+	// configured to keep them for a while.
 	c.rateLimitTotal.Reset()
 	c.rateLimitRemaining.Reset()
 	c.rateLimitUsage.Reset()
+	c.rateLimitUsed.Reset()
+	c.rateLimitReset.Reset()
+	c.secondsUntilReset.Reset()
+	c.consumptionRate.Reset()
+	c.secondsUntilEmpty.Reset()
+	c.rateLimitAge.Reset()
+	c.rateLimitStale.Reset()
+	c.success.Reset()
+	c.duration.Reset()
+	c.lastSuccess.Reset()
+	c.tokenExpiration.Reset()
+	c.tokenInfo.Reset()
+	c.installationInfo.Reset()
+
+	now := time.Now()
+	for _, rl := range c.limits {
+		c.setRateLimitTotal(rl)
+		c.setRateLimitRemaining(rl)
+		c.setRateLimitUsage(rl)
+		c.setRateLimitUsed(rl)
+		c.setRateLimitReset(rl, now)
+		c.setConsumptionRate(rl)
+		c.setToken(rl)
+		if c.stale > 0 {
+			c.setStaleness(rl, now)
+		}
+	}
 
-	// Only collect if Done is not yet closed.
-	// The context may be closed by Shutdown().
-	// If the collector has been shut down then
-	// let the gatherer collect reset metrics only.
-	if c.ctx.Err() == nil {
-		c.collectAll(c.ctx)
+	for name, st := range c.status {
+		c.setStatusMetrics(name, st)
 	}
 
 	c.rateLimitTotal.Collect(ch)
 	c.rateLimitRemaining.Collect(ch)
 	c.rateLimitUsage.Collect(ch)
+	c.rateLimitUsed.Collect(ch)
+	c.rateLimitReset.Collect(ch)
+	c.secondsUntilReset.Collect(ch)
+	c.consumptionRate.Collect(ch)
+	c.secondsUntilEmpty.Collect(ch)
+	c.rateLimitAge.Collect(ch)
+	c.rateLimitStale.Collect(ch)
+	c.success.Collect(ch)
+	c.duration.Collect(ch)
+	c.lastSuccess.Collect(ch)
+	c.errors.Collect(ch)
+	c.retries.Collect(ch)
+	c.tokenExpiration.Collect(ch)
+	c.tokenInfo.Collect(ch)
+	c.installationInfo.Collect(ch)
+}
+
+func (c *Collector) setStatusMetrics(name string, st *collectionStatus) {
+	success := 0.0
+	if st.success {
+		success = 1
+	}
+
+	c.success.WithLabelValues(name, st.kind).Set(success)
+	c.duration.WithLabelValues(name, st.kind).Set(st.duration.Seconds())
+	if !st.lastSuccess.IsZero() {
+		c.lastSuccess.WithLabelValues(name, st.kind).Set(float64(st.lastSuccess.UnixNano()) / 1e9)
+	}
+
+	for _, i := range st.installations {
+		c.installationInfo.
+			WithLabelValues(name, fmt.Sprint(i.AppID), fmt.Sprint(i.ID), i.Account, i.AccountType, i.RepositorySelection, permissions(i.Permissions)).
+			Set(1)
+	}
+}
+
+// permissions formats the permissions as sorted
+// comma separated pairs, e.g. "contents:read,metadata:read".
+func permissions(p map[string]string) string {
+	pairs := make([]string, 0, len(p))
+	for k, v := range p {
+		pairs = append(pairs, k+":"+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
 }
 
 func (c *Collector) setRateLimitTotal(rl *github.RateLimit) {
@@ -204,6 +926,89 @@ func (c *Collector) setRateLimitUsage(rl *github.RateLimit) {
 		Set(float64(rl.Limit-rl.Remaining) / float64(rl.Limit))
 }
 
+func (c *Collector) setRateLimitUsed(rl *github.RateLimit) {
+	c.rateLimitUsed.
+		WithLabelValues(labels(rl)...).
+		Set(float64(rl.Used))
+}
+
+func (c *Collector) setConsumptionRate(rl *github.RateLimit) {
+	rate, ok := c.consumption[seriesKey(rl)]
+	if !ok {
+		return
+	}
+
+	c.consumptionRate.
+		WithLabelValues(labels(rl)...).
+		Set(rate)
+
+	until := math.Inf(1)
+	if rate > 0 {
+		until = float64(rl.Remaining) / rate
+	}
+
+	c.secondsUntilEmpty.
+		WithLabelValues(labels(rl)...).
+		Set(until)
+}
+
+func (c *Collector) setStaleness(rl *github.RateLimit, now time.Time) {
+	if !rl.Time.IsZero() {
+		c.rateLimitAge.
+			WithLabelValues(labels(rl)...).
+			Set(now.Sub(rl.Time).Seconds())
+	}
+
+	stale := 0.0
+	if st, ok := c.status[rl.AppName]; ok && !st.success {
+		stale = 1
+	}
+
+	c.rateLimitStale.
+		WithLabelValues(labels(rl)...).
+		Set(stale)
+}
+
+func (c *Collector) setRateLimitReset(rl *github.RateLimit, now time.Time) {
+	if rl.Reset.IsZero() {
+		return
+	}
+
+	c.rateLimitReset.
+		WithLabelValues(labels(rl)...).
+		Set(float64(rl.Reset.Unix()))
+
+	// The window has already been reset if the
+	// snapshot is older than the reset time.
+	until := rl.Reset.Sub(now).Seconds()
+	if until < 0 {
+		until = 0
+	}
+
+	c.secondsUntilReset.
+		WithLabelValues(labels(rl)...).
+		Set(until)
+}
+
+// setToken sets the token metrics of the credential. All rate
+// limits of a credential share the token, so the metrics are set
+// to the same values for every resource.
+func (c *Collector) setToken(rl *github.RateLimit) {
+	if rl.Token == nil {
+		return
+	}
+
+	c.tokenInfo.
+		WithLabelValues(rl.AppName, rl.AppKind, rl.Token.Kind, strings.Join(rl.Token.Scopes, ","), rl.Token.Owner).
+		Set(1)
+
+	if !rl.Token.Expiration.IsZero() {
+		c.tokenExpiration.
+			WithLabelValues(rl.AppName, rl.AppKind).
+			Set(float64(rl.Token.Expiration.Unix()))
+	}
+}
+
 func labels(rl *github.RateLimit) []string {
 	return []string{
 		rl.AppName,
@@ -211,43 +1016,187 @@ func labels(rl *github.RateLimit) []string {
 		rl.AppKind,
 		fmt.Sprint(rl.AppID),
 		fmt.Sprint(rl.AppInstallationID),
+		rl.APIHost,
 	}
 }
 
-func (c *Collector) collectAll(ctx context.Context) {
+// collectAll collects the rate limits of all credentials, at most
+// the configured amount of credentials at a time.
+func (c *Collector) collectAll(ctx context.Context) []*collection {
+	c.mtx.Lock()
+	credentials := c.credentials
+	c.mtx.Unlock()
+
+	collections := make([]*collection, len(credentials))
 	var wg sync.WaitGroup
-	wg.Add(len(c.credentials))
-	defer wg.Wait()
 
-	for _, credential := range c.credentials {
-		appName := credential.AppName
-		rls, err := c.factory.Create(ctx, credential)
-		if err != nil {
-			c.log.Errorf("collector %v: %v", appName, err)
-			wg.Done()
+	for i, credential := range credentials {
+		col := &collection{credential: credential}
+		collections[i] = col
+
+		if !c.limiter.acquire(ctx, nil) {
+			col.err = ctx.Err()
 			continue
 		}
 
+		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := c.collectOne(ctx, rls); err != nil {
-				c.log.Errorf("collector %v: %v", appName, err)
+			defer c.limiter.release()
+
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			col.start = time.Now()
+			col.limits, col.err = c.collect(ctx, col.credential)
+			if col.err == nil {
+				col.installations = c.installations(ctx, col.credential)
 			}
+			col.duration = time.Since(col.start)
 		}()
 	}
+
+	wg.Wait()
+
+	return collections
 }
 
-func (c *Collector) collectOne(ctx context.Context, rls RateLimitsService) error {
-	limits, err := rls.RateLimits(ctx)
+// probe collects the rate limits of the credential with given name into
+// a new collector, which reuses the GitHub clients and the limiter of c. If resource is not
+// empty then only the rate limit of the resource is kept. probe returns
+// nil if there is no credential with given name.
+func (c *Collector) probe(ctx context.Context, name, resource string) *Collector {
+	c.mtx.Lock()
+	var credential *Credential
+	for _, cr := range c.credentials {
+		if cr.AppName == name {
+			credential = cr
+		}
+	}
+	st := c.status[name]
+	c.mtx.Unlock()
+
+	if credential == nil {
+		return nil
+	}
+
+	p := c.params
+	p.Credentials = []*Credential{credential}
+	probe := NewCollector(p)
+	// The probe is never started, so it doesn't need its context.
+	probe.cancel()
+	probe.clients = c.clients
+	// Probes count against the concurrency of c.
+	probe.limiter = c.limiter
+	if st != nil {
+		// Don't read the installation on every probe.
+		probe.status[name] = &collectionStatus{installations: st.installations, installationTime: st.installationTime}
+	}
+
+	col := probe.collectAll(ctx)[0]
+
+	probe.mtx.Lock()
+	defer probe.mtx.Unlock()
+
+	probe.setStatus(col)
+	for _, rl := range col.limits {
+		if resource == "" || rl.Resource == resource {
+			probe.limits = append(probe.limits, rl)
+		}
+	}
+
+	return probe
+}
+
+func (c *Collector) collect(ctx context.Context, credential *Credential) ([]*github.RateLimit, error) {
+	appName := credential.AppName
+	rls, err := c.clients.Get(ctx, credential)
 	if err != nil {
+		c.log.Errorw("creating GitHub client failed", logFields(credential, err)...)
+		return nil, err
+	}
+
+	retry := c.retry
+	if _, ok := rls.(*installationsService); ok {
+		// The installations are retried one by one.
+		retry.MaxRetries = 0
+	}
+
+	var limits []*github.RateLimit
+	err = retry.Do(ctx, func(ctx context.Context) error {
+		limits, err = rls.RateLimits(ctx)
 		return err
+	}, func(err error, wait time.Duration) {
+		c.retries.WithLabelValues(appName, credential.Kind(), github.ErrorClass(err)).Inc()
+		c.log.Warnw("retrying collection", append(logFields(credential, err), "backoff", wait.Round(time.Millisecond))...)
+	})
+	if err != nil {
+		// Rejected credentials may have been rotated or revoked
+		// meanwhile, so start with a fresh client next time.
+		if github.IsAuthError(err) {
+			c.clients.Invalidate(appName)
+		}
+		c.log.Errorw("collection failed", logFields(credential, err)...)
+		return nil, err
 	}
 
-	for _, rl := range limits {
-		c.setRateLimitTotal(rl)
-		c.setRateLimitRemaining(rl)
-		c.setRateLimitUsage(rl)
+	c.log.Debugw("collected rate limits", append(logFields(credential, nil), "resources", len(limits))...)
+
+	return limits, nil
+}
+
+// installations reads the installations of a GitHub App credential if
+// they are due for a refresh. installations returns nil otherwise or if
+// the installations cannot be read.
+func (c *Collector) installations(ctx context.Context, credential *Credential) []*github.Installation {
+	if credential.Type != GitHubApp {
+		return nil
+	}
+
+	c.mtx.Lock()
+	st, ok := c.status[credential.AppName]
+	due := !ok || st.installations == nil || time.Since(st.installationTime) >= c.installationInterval
+	c.mtx.Unlock()
+
+	if !due {
+		return nil
+	}
+
+	rls, err := c.clients.Get(ctx, credential)
+	if err != nil {
+		return nil
+	}
+
+	is, ok := rls.(InstallationService)
+	if !ok {
+		return nil
+	}
+
+	i, err := is.Installations(ctx)
+	if err != nil {
+		if !errors.Is(err, github.ErrNoAppClient) {
+			c.log.Warnw("reading app installation failed", logFields(credential, err)...)
+		}
+
+		return nil
+	}
+
+	return i
+}
+
+// logFields returns the structured log fields describing
+// the credential and, if not nil, the error.
+func logFields(c *Credential, err error) []any {
+	fields := []any{"credential", c.AppName, "type", c.Kind()}
+	if c.AppCredential != nil {
+		fields = append(fields, "app_id", c.AppCredential.ID, "installation_id", c.AppCredential.InstallationID)
+	}
+	if c.BaseURL() != "" {
+		fields = append(fields, "base_url", c.BaseURL())
+	}
+	if err != nil {
+		fields = append(fields, "error_class", github.ErrorClass(err), "error", err)
 	}
 
-	return nil
+	return fields
 }
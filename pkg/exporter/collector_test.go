@@ -1,19 +1,28 @@
 package exporter
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"net/http"
+	"sync"
 	"testing"
 	"time"
 
+	gogithub "github.com/google/go-github/v48/github"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
 	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/github"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type instrumenterMock struct{}
@@ -24,37 +33,123 @@ type rateLimitsServiceMock struct {
 	resource          string
 	limit             int
 	remaining         int
+	used              int
+	reset             time.Time
 	appName           string
 	appKind           string
 	appID             string
 	appInstallationID string
+	token             *github.Token
+	installations     []*github.Installation
+	installationCalls int
+	calls             int
+	err               error
+	transientErr      error
+	failures          int
+	delay             time.Duration
+	mtx               sync.Mutex
+	active            int
+	maxActive         int
 }
 
-func (rls *rateLimitsServiceMock) RateLimits(context.Context) ([]*github.RateLimit, error) {
+func (rls *rateLimitsServiceMock) RateLimits(ctx context.Context) ([]*github.RateLimit, error) {
+	rls.mtx.Lock()
+	rls.calls++
+	rls.mtx.Unlock()
+
+	if rls.delay > 0 {
+		rls.mtx.Lock()
+		rls.active++
+		if rls.active > rls.maxActive {
+			rls.maxActive = rls.active
+		}
+		rls.mtx.Unlock()
+
+		defer func() {
+			rls.mtx.Lock()
+			rls.active--
+			rls.mtx.Unlock()
+		}()
+
+		select {
+		case <-time.After(rls.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	rls.mtx.Lock()
+	if rls.failures > 0 {
+		rls.failures--
+		rls.mtx.Unlock()
+		return nil, rls.transientErr
+	}
+	rls.mtx.Unlock()
+
+	if rls.err != nil {
+		return nil, rls.err
+	}
+
 	limits := []*github.RateLimit{
 		{
 			Resource:          rls.resource,
 			Limit:             rls.limit,
 			Remaining:         rls.remaining,
+			Used:              rls.used,
+			Reset:             rls.reset,
+			Time:              time.Now(),
 			AppName:           rls.appName,
 			AppKind:           rls.appKind,
 			AppID:             rls.appID,
 			AppInstallationID: rls.appInstallationID,
+			Token:             rls.token,
 		},
 	}
 
 	return limits, nil
 }
 
+func (rls *rateLimitsServiceMock) Calls() int {
+	rls.mtx.Lock()
+	defer rls.mtx.Unlock()
+
+	return rls.calls
+}
+
+func (rls *rateLimitsServiceMock) Installations(context.Context) ([]*github.Installation, error) {
+	rls.mtx.Lock()
+	defer rls.mtx.Unlock()
+	rls.installationCalls++
+
+	if rls.installations == nil {
+		return nil, github.ErrNoAppClient
+	}
+
+	return rls.installations, nil
+}
+
 type rateLimitsServiceFactoryMock struct {
 	service      *rateLimitsServiceMock
 	instrumenter Instrumenter
+	mtx          sync.Mutex
+	calls        int
 }
 
 func (f *rateLimitsServiceFactoryMock) Create(context.Context, *Credential) (RateLimitsService, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.calls++
+
 	return f.service, nil
 }
 
+func (f *rateLimitsServiceFactoryMock) Calls() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.calls
+}
+
 func newRateLimitsServiceFactoryParamsMock() RateLimitsServiceFactoryParams {
 	return RateLimitsServiceFactoryParams{
 		Instrumenter:             &instrumenterMock{},
@@ -77,7 +172,7 @@ func TestRateLimitsServiceFactory(t *testing.T) {
 				AppCredential: &AppCredential{
 					ID:             1,
 					InstallationID: 2,
-					Key:            generatePrivateKey(t),
+					Key:            Secret(generatePrivateKey(t)),
 				},
 			},
 		)
@@ -127,11 +222,659 @@ func TestNewCollector(t *testing.T) {
 		assert.NotNil(t, c.rateLimitTotal)
 		assert.NotNil(t, c.rateLimitRemaining)
 		assert.NotNil(t, c.rateLimitUsage)
+		assert.NotNil(t, c.rateLimitReset)
+		assert.NotNil(t, c.secondsUntilReset)
 		assert.NotNil(t, c.ctx)
 		assert.NotNil(t, c.cancel)
 	})
 }
 
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	const metric = "gh_rate_limit_exporter_rate_limit_total"
+
+	t.Run("polls rate limits in the background", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		c := NewCollector(cp)
+		c.Start()
+		defer c.Shutdown()
+
+		assert.Eventually(t, func() bool {
+			return testutil.CollectAndCount(c, metric) == 1
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, float64(1000), testutil.ToFloat64(c.rateLimitTotal))
+	})
+
+	t.Run("serves cached rate limits without calling GitHub API", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		rls := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, 1, testutil.CollectAndCount(c, metric))
+		}
+		assert.Equal(t, 1, rls.Calls())
+	})
+
+	t.Run("reports no rate limits before the first poll", func(t *testing.T) {
+		c := NewCollector(newTestCollectorParams())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c, metric))
+	})
+
+	t.Run("reports reset time and seconds until reset", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		reset := time.Now().Add(time.Hour).Truncate(time.Second)
+		cp.Factory.(*rateLimitsServiceFactoryMock).service.reset = reset
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+
+		assert.Equal(t, 1, testutil.CollectAndCount(c, "gh_rate_limit_exporter_rate_limit_reset_timestamp_seconds"))
+		assert.Equal(t, float64(reset.Unix()), testutil.ToFloat64(c.rateLimitReset))
+		assert.InDelta(t, time.Hour.Seconds(), testutil.ToFloat64(c.secondsUntilReset), 2)
+	})
+
+	t.Run("reports zero seconds until reset once the window has been reset", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		cp.Factory.(*rateLimitsServiceFactoryMock).service.reset = time.Now().Add(-time.Minute)
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+
+		testutil.CollectAndCount(c)
+		assert.Equal(t, float64(0), testutil.ToFloat64(c.secondsUntilReset))
+	})
+
+	t.Run("stops polling on shutdown", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		rls := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		interval := Interval(10 * time.Millisecond)
+		cp.Interval = &interval
+		c := NewCollector(cp)
+		c.Start()
+
+		assert.Eventually(t, func() bool { return rls.Calls() > 1 }, time.Second, time.Millisecond)
+		c.Shutdown()
+		calls := rls.Calls()
+		<-time.After(50 * time.Millisecond)
+
+		assert.Equal(t, calls, rls.Calls())
+	})
+}
+
+func TestCollectorSetCredentials(t *testing.T) {
+	t.Parallel()
+
+	t.Run("drops series of removed credentials", func(t *testing.T) {
+		c := NewCollector(newTestCollectorParams())
+		c.refresh(context.Background())
+
+		c.SetCredentials(nil)
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c))
+		assert.Empty(t, c.clients.entries)
+	})
+
+	t.Run("collects rate limits for added credentials", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		credentials := cp.Credentials
+		cp.Credentials = nil
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+		assert.Equal(t, 0, testutil.CollectAndCount(c))
+
+		c.SetCredentials(credentials)
+		c.refresh(context.Background())
+
+		assert.Equal(t, 7, testutil.CollectAndCount(c))
+	})
+}
+
+func TestCollectorStatus(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports successful collection", func(t *testing.T) {
+		c := NewCollector(newTestCollectorParams())
+		start := time.Now()
+		c.refresh(context.Background())
+
+		assert.Equal(t, 3, testutil.CollectAndCount(c,
+			"gh_rate_limit_exporter_collection_success",
+			"gh_rate_limit_exporter_collection_duration_seconds",
+			"gh_rate_limit_exporter_last_success_timestamp_seconds",
+		))
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.success.WithLabelValues("test-app", "gh-pat")))
+		assert.GreaterOrEqual(t, testutil.ToFloat64(c.lastSuccess.WithLabelValues("test-app", "gh-pat")), float64(start.Unix()))
+		assert.Equal(t, 0, testutil.CollectAndCount(c, "gh_rate_limit_exporter_collection_errors_total"))
+	})
+
+	t.Run("reports failed collection by error class", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		service.err = &gogithub.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway, Request: &http.Request{}}}
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+		c.refresh(context.Background())
+
+		testutil.CollectAndCount(c)
+		assert.Equal(t, float64(0), testutil.ToFloat64(c.success.WithLabelValues("test-app", "gh-pat")))
+		assert.Equal(t, float64(2), testutil.ToFloat64(c.errors.WithLabelValues("test-app", "gh-pat", github.ErrorClass5xx)))
+		assert.Equal(t, 0, testutil.CollectAndCount(c, "gh_rate_limit_exporter_last_success_timestamp_seconds"))
+		assert.Equal(t, 0, testutil.CollectAndCount(c, "gh_rate_limit_exporter_rate_limit_total"))
+	})
+
+	t.Run("keeps last success time after failure", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+		service.err = errors.New("boom")
+		c.refresh(context.Background())
+
+		assert.Equal(t, 1, testutil.CollectAndCount(c, "gh_rate_limit_exporter_last_success_timestamp_seconds"))
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.errors.WithLabelValues("test-app", "gh-pat", github.ErrorClassOther)))
+	})
+
+	t.Run("drops status of removed credentials", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		cp.Factory.(*rateLimitsServiceFactoryMock).service.err = errors.New("boom")
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+
+		c.SetCredentials(nil)
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c))
+	})
+}
+
+func TestCollectorCredentialStatus(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports no collection before the first round", func(t *testing.T) {
+		c := NewCollector(newTestCollectorParams())
+
+		status := c.Status()
+
+		if assert.Len(t, status, 1) {
+			assert.Equal(t, "test-app", status[0].Name)
+			assert.Equal(t, "gh-pat", status[0].Type)
+			assert.Nil(t, status[0].LastCollection)
+			assert.Empty(t, status[0].RateLimits)
+		}
+	})
+
+	t.Run("reports rate limits of successful collection", func(t *testing.T) {
+		c := NewCollector(newTestCollectorParams())
+		c.refresh(context.Background())
+
+		status := c.Status()
+
+		if assert.Len(t, status, 1) {
+			assert.NotNil(t, status[0].LastCollection)
+			assert.Equal(t, status[0].LastCollection, status[0].LastSuccess)
+			assert.Empty(t, status[0].LastError)
+			assert.Equal(t, []ResourceLimit{{Resource: "test-resource", Limit: 1000, Remaining: 500}}, status[0].RateLimits)
+		}
+	})
+
+	t.Run("reports last error of failed collection", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+		service.err = errors.New("boom")
+		c.refresh(context.Background())
+
+		status := c.Status()
+
+		if assert.Len(t, status, 1) {
+			assert.True(t, status[0].LastCollection.After(*status[0].LastSuccess))
+			assert.Equal(t, "boom", status[0].LastError)
+			assert.Equal(t, github.ErrorClassOther, status[0].ErrorClass)
+			assert.Empty(t, status[0].RateLimits)
+		}
+	})
+
+	t.Run("reports app ids without secrets", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		cp.Credentials = []*Credential{
+			{Type: GitHubApp, AppName: "b-app", AppCredential: &AppCredential{ID: 1, InstallationID: 2, Key: "secret-key"}},
+			{Type: GitHubPAT, AppName: "a-pat", PAT: &PAT{Token: "secret-token"}},
+		}
+		c := NewCollector(cp)
+
+		status := c.Status()
+		b, err := json.Marshal(status)
+
+		assert.NoError(t, err)
+		assert.NotContains(t, string(b), "secret-")
+		if assert.Len(t, status, 2) {
+			assert.Equal(t, "a-pat", status[0].Name)
+			assert.Equal(t, int64(1), status[1].AppID)
+			assert.Equal(t, int64(2), status[1].InstallationID)
+		}
+	})
+}
+
+func TestCollectorToken(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports token expiration and info", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		expiration := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+		cp.Factory.(*rateLimitsServiceFactoryMock).service.token = &github.Token{
+			Kind:       github.TokenKindClassic,
+			Scopes:     []string{"repo", "workflow"},
+			Expiration: expiration,
+			Owner:      "octocat",
+		}
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+
+		assert.Equal(t, 1, testutil.CollectAndCount(c, "gh_rate_limit_exporter_token_expiration_timestamp_seconds"))
+		assert.Equal(t, float64(expiration.Unix()), testutil.ToFloat64(c.tokenExpiration.WithLabelValues("test-app", "gh-pat")))
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.tokenInfo.WithLabelValues("test-app", "gh-pat", "classic", "repo,workflow", "octocat")))
+	})
+
+	t.Run("omits expiration of non-expiring token", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		cp.Factory.(*rateLimitsServiceFactoryMock).service.token = &github.Token{Kind: github.TokenKindFineGrained}
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c, "gh_rate_limit_exporter_token_expiration_timestamp_seconds"))
+		assert.Equal(t, 1, testutil.CollectAndCount(c, "gh_rate_limit_exporter_token_info"))
+	})
+
+	t.Run("reports no token metrics without token", func(t *testing.T) {
+		c := NewCollector(newTestCollectorParams())
+		c.refresh(context.Background())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c,
+			"gh_rate_limit_exporter_token_expiration_timestamp_seconds",
+			"gh_rate_limit_exporter_token_info",
+		))
+	})
+}
+
+func TestCollectorInstallation(t *testing.T) {
+	t.Parallel()
+
+	newParams := func() CollectorParams {
+		cp := newTestCollectorParams()
+		cp.Credentials = []*Credential{
+			{Type: GitHubApp, AppName: "test-app", AppCredential: &AppCredential{ID: 1, InstallationID: 2, Key: "key"}},
+		}
+		cp.Factory.(*rateLimitsServiceFactoryMock).service.installations = []*github.Installation{{
+			ID:                  2,
+			AppID:               1,
+			Account:             "foo",
+			AccountType:         "organization",
+			RepositorySelection: "selected",
+			Permissions:         map[string]string{"metadata": "read", "contents": "write"},
+		}}
+
+		return cp
+	}
+
+	t.Run("reports installation info", func(t *testing.T) {
+		c := NewCollector(newParams())
+		c.refresh(context.Background())
+
+		assert.Equal(t, 1, testutil.CollectAndCount(c, "gh_rate_limit_exporter_app_installation_info"))
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.installationInfo.WithLabelValues(
+			"test-app", "1", "2", "foo", "organization", "selected", "contents:write,metadata:read",
+		)))
+	})
+
+	t.Run("refreshes installation on slower schedule", func(t *testing.T) {
+		cp := newParams()
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		c := NewCollector(cp)
+
+		c.refresh(context.Background())
+		c.refresh(context.Background())
+		assert.Equal(t, 1, service.installationCalls)
+
+		c.installationInterval = 0
+		c.refresh(context.Background())
+		assert.Equal(t, 2, service.installationCalls)
+	})
+
+	t.Run("retries failed installation reads", func(t *testing.T) {
+		cp := newParams()
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		service.installations = nil
+		c := NewCollector(cp)
+
+		c.refresh(context.Background())
+		c.refresh(context.Background())
+
+		assert.Equal(t, 2, service.installationCalls)
+		assert.Equal(t, 0, testutil.CollectAndCount(c, "gh_rate_limit_exporter_app_installation_info"))
+	})
+
+	t.Run("probe reuses polled installation", func(t *testing.T) {
+		cp := newParams()
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+
+		probe := c.probe(context.Background(), "test-app", "")
+
+		assert.Equal(t, 1, service.installationCalls)
+		assert.Equal(t, 1, testutil.CollectAndCount(probe, "gh_rate_limit_exporter_app_installation_info"))
+	})
+
+	t.Run("probe releases its context", func(t *testing.T) {
+		c := NewCollector(newParams())
+
+		probe := c.probe(context.Background(), "test-app", "")
+
+		assert.ErrorIs(t, probe.ctx.Err(), context.Canceled)
+	})
+
+	t.Run("reads no installation for PATs", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+
+		assert.Equal(t, 0, service.installationCalls)
+	})
+}
+
+func TestCollectorLimits(t *testing.T) {
+	t.Parallel()
+
+	credentials := func(n int) []*Credential {
+		var credentials []*Credential
+		for i := 0; i < n; i++ {
+			credentials = append(credentials, &Credential{Type: GitHubPAT, AppName: fmt.Sprint("test-app-", i), PAT: &PAT{Token: "token"}})
+		}
+
+		return credentials
+	}
+
+	t.Run("times out slow collections", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		cp.Factory.(*rateLimitsServiceFactoryMock).service.delay = time.Minute
+		timeout := CollectionTimeout(10 * time.Millisecond)
+		cp.Timeout = &timeout
+		c := NewCollector(cp)
+
+		start := time.Now()
+		c.refresh(context.Background())
+
+		assert.Less(t, time.Since(start), time.Second)
+		testutil.CollectAndCount(c)
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.errors.WithLabelValues("test-app", "gh-pat", github.ErrorClassNetwork)))
+	})
+
+	t.Run("limits concurrent collections", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		service.delay = 5 * time.Millisecond
+		cp.Credentials = credentials(10)
+		concurrency := Concurrency(3)
+		cp.Concurrency = &concurrency
+		c := NewCollector(cp)
+
+		c.refresh(context.Background())
+
+		assert.Equal(t, 3, service.maxActive)
+		assert.Equal(t, 10, testutil.CollectAndCount(c, "gh_rate_limit_exporter_collection_success"))
+	})
+
+	t.Run("limits concurrent probes", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		service.delay = 5 * time.Millisecond
+		concurrency := Concurrency(1)
+		cp.Concurrency = &concurrency
+		c := NewCollector(cp)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.probe(context.Background(), "test-app", "")
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 5, service.Calls())
+		assert.Equal(t, 1, service.maxActive)
+	})
+
+	t.Run("waits for the first polling round", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		cp.Factory.(*rateLimitsServiceFactoryMock).service.delay = 20 * time.Millisecond
+		c := NewCollector(cp)
+		assert.NoError(t, c.Wait(context.Background()), "collector is not started")
+
+		c.Start()
+		defer c.Shutdown()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, c.Wait(ctx), context.DeadlineExceeded)
+
+		assert.NoError(t, c.Wait(context.Background()))
+		assert.Equal(t, 1, testutil.CollectAndCount(c, "gh_rate_limit_exporter_rate_limit_total"))
+	})
+}
+
+func TestCollectorRetries(t *testing.T) {
+	t.Parallel()
+
+	serverError := &gogithub.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway, Request: &http.Request{}}}
+
+	newCollector := func(service func(*rateLimitsServiceMock)) *Collector {
+		cp := newTestCollectorParams()
+		service(cp.Factory.(*rateLimitsServiceFactoryMock).service)
+		retries := MaxRetries(2)
+		cp.MaxRetries = &retries
+		c := NewCollector(cp)
+		c.retry.MinBackoff = time.Millisecond
+		c.retry.MaxBackoff = 10 * time.Millisecond
+
+		return c
+	}
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		c := newCollector(func(s *rateLimitsServiceMock) {
+			s.transientErr = serverError
+			s.failures = 2
+		})
+
+		c.refresh(context.Background())
+
+		assert.Equal(t, 1, testutil.CollectAndCount(c, "gh_rate_limit_exporter_rate_limit_total"))
+		assert.Equal(t, float64(2), testutil.ToFloat64(c.retries.WithLabelValues("test-app", "gh-pat", github.ErrorClass5xx)))
+		assert.Equal(t, 0, testutil.CollectAndCount(c, "gh_rate_limit_exporter_collection_errors_total"))
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		c := newCollector(func(s *rateLimitsServiceMock) { s.err = serverError })
+
+		c.refresh(context.Background())
+
+		assert.Equal(t, float64(2), testutil.ToFloat64(c.retries.WithLabelValues("test-app", "gh-pat", github.ErrorClass5xx)))
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.errors.WithLabelValues("test-app", "gh-pat", github.ErrorClass5xx)))
+	})
+
+	t.Run("doesn't retry rejected credentials", func(t *testing.T) {
+		c := newCollector(func(s *rateLimitsServiceMock) {
+			s.err = &gogithub.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnauthorized, Request: &http.Request{}}}
+		})
+
+		c.refresh(context.Background())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c, "gh_rate_limit_exporter_collection_retries_total"))
+	})
+}
+
+func TestCollectorStaleness(t *testing.T) {
+	t.Parallel()
+
+	const metric = "gh_rate_limit_exporter_rate_limit_total"
+
+	t.Run("drops rate limits on failure by default", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+		service.err = errors.New("boom")
+		c.refresh(context.Background())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c, metric))
+		assert.Equal(t, 0, testutil.CollectAndCount(c, "gh_rate_limit_exporter_rate_limit_stale"))
+	})
+
+	t.Run("keeps last known rate limits marked as stale", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		stale := StaleIntervals(2)
+		cp.Stale = &stale
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+		testutil.CollectAndCount(c)
+		assert.Equal(t, float64(0), testutil.ToFloat64(c.rateLimitStale))
+
+		service.err = errors.New("boom")
+		service.remaining = 1
+		c.refresh(context.Background())
+		c.refresh(context.Background())
+
+		assert.Equal(t, 1, testutil.CollectAndCount(c, metric))
+		assert.Equal(t, float64(500), testutil.ToFloat64(c.rateLimitRemaining))
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.rateLimitStale))
+		assert.GreaterOrEqual(t, testutil.ToFloat64(c.rateLimitAge), float64(0))
+	})
+
+	t.Run("drops last known rate limits after given intervals", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		stale := StaleIntervals(1)
+		cp.Stale = &stale
+		interval := Interval(time.Millisecond)
+		cp.Interval = &interval
+		service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+		c := NewCollector(cp)
+		c.refresh(context.Background())
+
+		service.err = errors.New("boom")
+		time.Sleep(5 * time.Millisecond)
+		c.refresh(context.Background())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c, metric))
+	})
+}
+
+type failingFactoryMock struct{}
+
+func (f *failingFactoryMock) Create(_ context.Context, c *Credential) (RateLimitsService, error) {
+	return nil, fmt.Errorf("creating client for %v failed: %+v %#v", c, *c, c)
+}
+
+func TestCollectorLogsNoSecrets(t *testing.T) {
+	const token = "ghp_secret-token"
+
+	var buf bytes.Buffer
+	log := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	)).Sugar()
+
+	cp := newTestCollectorParams()
+	cp.Log = log
+	cp.Credentials = []*Credential{{Type: GitHubPAT, AppName: "test-app", PAT: &PAT{Token: token}}}
+	cp.Factory = &failingFactoryMock{}
+	c := NewCollector(cp)
+	c.refresh(context.Background())
+
+	cp.Factory = &rateLimitsServiceFactoryMock{service: &rateLimitsServiceMock{err: errors.New("boom")}}
+	c = NewCollector(cp)
+	c.refresh(context.Background())
+	c.SetCredentials([]*Credential{{Type: GitHubPAT, AppName: "test-app", PAT: &PAT{Token: "rotated"}}})
+
+	assert.Contains(t, buf.String(), "collection failed")
+	assert.Contains(t, buf.String(), "creating client for test-app (gh-pat) failed")
+	assert.NotContains(t, buf.String(), token)
+	assert.NotContains(t, buf.String(), "rotated")
+}
+
+func TestDiffCredentials(t *testing.T) {
+	pat := func(name, token string) *Credential {
+		return &Credential{Type: GitHubPAT, AppName: name, PAT: &PAT{Token: Secret(token)}}
+	}
+
+	added, removed, changed := diffCredentials(
+		[]*Credential{pat("a", "1"), pat("b", "1"), pat("c", "1")},
+		[]*Credential{pat("b", "1"), pat("c", "2"), pat("d", "1")},
+	)
+
+	assert.Equal(t, []string{"d"}, added)
+	assert.Equal(t, []string{"a"}, removed)
+	assert.Equal(t, []string{"c"}, changed)
+}
+
+func TestConsumptionRates(t *testing.T) {
+	now := time.Now()
+	reset := now.Add(time.Hour)
+	rl := func(used int, reset, at time.Time) *github.RateLimit {
+		return &github.RateLimit{AppName: "a", Resource: "core", Limit: 5000, Remaining: 5000 - used, Used: used, Reset: reset, Time: at}
+	}
+
+	t.Run("computes requests per second between polls", func(t *testing.T) {
+		rates := consumptionRates(
+			[]*github.RateLimit{rl(100, reset, now.Add(-10*time.Second))},
+			[]*github.RateLimit{rl(150, reset, now)},
+		)
+
+		assert.Equal(t, map[string]float64{seriesKey(rl(0, reset, now)): 5}, rates)
+	})
+
+	t.Run("counts all used requests after the window was reset", func(t *testing.T) {
+		rates := consumptionRates(
+			[]*github.RateLimit{rl(4000, now.Add(-time.Second), now.Add(-10*time.Second))},
+			[]*github.RateLimit{rl(20, reset, now)},
+		)
+
+		assert.Equal(t, map[string]float64{seriesKey(rl(0, reset, now)): 2}, rates)
+	})
+
+	t.Run("skips series without previous poll", func(t *testing.T) {
+		rates := consumptionRates(nil, []*github.RateLimit{rl(20, reset, now)})
+
+		assert.Empty(t, rates)
+	})
+}
+
+func TestCollectorConsumption(t *testing.T) {
+	cp := newTestCollectorParams()
+	service := cp.Factory.(*rateLimitsServiceFactoryMock).service
+	service.reset = time.Now().Add(time.Hour)
+	c := NewCollector(cp)
+
+	service.used = 400
+	c.refresh(context.Background())
+	testutil.CollectAndCount(c)
+	assert.Equal(t, float64(400), testutil.ToFloat64(c.rateLimitUsed))
+	assert.Equal(t, 0, testutil.CollectAndCount(c, "gh_rate_limit_exporter_rate_limit_consumption_rate"))
+
+	time.Sleep(10 * time.Millisecond)
+	service.used = 500
+	c.refresh(context.Background())
+	testutil.CollectAndCount(c)
+
+	rate := testutil.ToFloat64(c.consumptionRate)
+	assert.Greater(t, rate, float64(0))
+	assert.InDelta(t, float64(service.remaining)/rate, testutil.ToFloat64(c.secondsUntilEmpty), 0.001)
+}
+
 func newTestCollectorParams() CollectorParams {
 	instrumenter := &instrumenterMock{}
 	service := &rateLimitsServiceMock{
@@ -145,9 +888,11 @@ func newTestCollectorParams() CollectorParams {
 		{Type: Type(service.appKind), AppName: service.appName, PAT: &PAT{Token: "token"}},
 	}
 	interval := Interval(1 * time.Second)
+	retries := MaxRetries(0)
 
 	return CollectorParams{
 		Interval:     &interval,
+		MaxRetries:   &retries,
 		Credentials:  credentials,
 		Instrumenter: instrumenter,
 		Factory:      &rateLimitsServiceFactoryMock{instrumenter: instrumenter, service: service},
@@ -1,9 +1,24 @@
 package exporter
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
+	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/github"
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
 )
@@ -12,6 +27,14 @@ type CredentialSource interface {
 	Credentials() []*Credential
 }
 
+// CredentialWatcher is implemented by credential sources
+// whose credentials may change while the exporter is running.
+type CredentialWatcher interface {
+	// Watch calls update with the complete set of credentials whenever
+	// the credentials have changed. Watch blocks until the context is done.
+	Watch(ctx context.Context, update func([]*Credential))
+}
+
 type Type string
 
 const (
@@ -19,25 +42,218 @@ const (
 	GitHubPAT Type = "gh-pat"
 )
 
+// Secret is a secret credential value. Secret never reveals the value
+// when formatted or marshalled, so credentials can't be leaked to logs
+// by accident. Use Value to access the value.
+type Secret string
+
+const redacted = "<redacted>"
+
+// Value returns the secret value.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
 type (
 	AppCredential struct {
-		ID             int64  `yaml:"appId"`
-		InstallationID int64  `yaml:"installationId"`
-		Key            string `yaml:"key"`
+		ID int64 `yaml:"appId"`
+		// InstallationID is the installation of the GitHub App. Zero
+		// discovers and monitors all installations of the GitHub App.
+		InstallationID int64 `yaml:"installationId"`
+		// Key is the private key of the GitHub App, either PEM or base64 encoded PEM.
+		Key Secret `yaml:"key"`
+		// KeyFile is the path of the private key file, an alternative to Key.
+		KeyFile string `yaml:"keyFile"`
+
+		// privateKey is the PEM encoded private key loaded by Validate.
+		privateKey Secret
 	}
 
 	PAT struct {
-		Token string `yaml:"token"`
+		Token Secret `yaml:"token"`
+	}
+
+	// Endpoint is the GitHub Enterprise Server the credential belongs to.
+	// Empty BaseURL means the public GitHub API.
+	Endpoint struct {
+		BaseURL   string `yaml:"baseURL"`
+		UploadURL string `yaml:"uploadURL"`
 	}
 
 	Credential struct {
 		Type           Type `yaml:"type"`
 		AppName        string
+		Endpoint       `yaml:",inline"`
 		*AppCredential `yaml:",inline"`
 		*PAT           `yaml:",inline"`
 	}
 )
 
+// clone returns a deep copy of the credential.
+func (c *Credential) clone() *Credential {
+	cp := *c
+	if c.AppCredential != nil {
+		app := *c.AppCredential
+		cp.AppCredential = &app
+	}
+	if c.PAT != nil {
+		pat := *c.PAT
+		cp.PAT = &pat
+	}
+
+	return &cp
+}
+
+// Validate checks that the credential is complete. The private key of
+// a GitHub App is loaded from Key or KeyFile and an error is returned
+// if the key is malformed. KeyFile is read from fs, or from the OS
+// filesystem if fs is nil.
+func (c *Credential) Validate(fs *afero.Afero) error {
+	if err := c.Endpoint.validate(); err != nil {
+		return fmt.Errorf("credential %v: %w", c.AppName, err)
+	}
+
+	switch c.Type {
+	case GitHubPAT:
+		// Without a token the rate limits of unauthenticated requests
+		// are collected, which the collector warns about.
+		if c.PAT == nil {
+			c.PAT = &PAT{}
+		}
+	case GitHubApp:
+		app := c.AppCredential
+		if app == nil || app.ID <= 0 {
+			return fmt.Errorf("credential %v: appId must be set", c.AppName)
+		}
+
+		if app.InstallationID < 0 {
+			return fmt.Errorf("credential %v: installationId must not be negative", c.AppName)
+		}
+
+		key := []byte(app.Key.Value())
+		switch {
+		case app.Key != "" && app.KeyFile != "":
+			return fmt.Errorf("credential %v: only one of key and keyFile may be set", c.AppName)
+		case app.KeyFile != "":
+			if fs == nil {
+				fs = &afero.Afero{Fs: afero.NewOsFs()}
+			}
+
+			b, err := fs.ReadFile(app.KeyFile)
+			if err != nil {
+				return fmt.Errorf("credential %v: %w", c.AppName, err)
+			}
+			key = b
+		}
+
+		pem, err := github.DecodePrivateKey(key)
+		if err != nil {
+			return fmt.Errorf("credential %v: %w", c.AppName, err)
+		}
+		app.privateKey = Secret(pem)
+	default:
+		return fmt.Errorf("credential %v: unknown kind: %v", c.AppName, c.Type)
+	}
+
+	return nil
+}
+
+func (e Endpoint) validate() error {
+	if e.BaseURL == "" && e.UploadURL != "" {
+		return errors.New("uploadURL requires baseURL")
+	}
+
+	if err := validateURL("baseURL", e.BaseURL); err != nil {
+		return err
+	}
+
+	return validateURL("uploadURL", e.UploadURL)
+}
+
+func validateURL(field, v string) error {
+	if v == "" {
+		return nil
+	}
+
+	u, err := url.Parse(v)
+	if err != nil {
+		return fmt.Errorf("invalid %v: %w", field, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid %v: %v is not an absolute http(s) URL", field, v)
+	}
+
+	return nil
+}
+
+// Fields of the credentials which are stored as key-value pairs,
+// e.g. in Kubernetes Secrets or in Vault.
+const (
+	FieldType           = "type"
+	FieldToken          = "token"
+	FieldAppID          = "appId"
+	FieldInstallationID = "installationId"
+	FieldKey            = "key"
+	FieldBaseURL        = "baseURL"
+	FieldUploadURL      = "uploadURL"
+)
+
+// credentialFromFields builds a credential from the
+// fields looked up by the get function.
+func credentialFromFields(name string, get func(field string) string) (*Credential, error) {
+	c := &Credential{
+		Type:     Type(get(FieldType)),
+		AppName:  name,
+		Endpoint: Endpoint{BaseURL: get(FieldBaseURL), UploadURL: get(FieldUploadURL)},
+	}
+
+	switch c.Type {
+	case GitHubPAT:
+		c.PAT = &PAT{Token: Secret(get(FieldToken))}
+	case GitHubApp:
+		id, err := strconv.ParseInt(get(FieldAppID), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v: %w", FieldAppID, err)
+		}
+
+		// Missing installation ID discovers all installations.
+		var installationID int64
+		if v := get(FieldInstallationID); v != "" {
+			installationID, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %v: %w", FieldInstallationID, err)
+			}
+		}
+
+		c.AppCredential = &AppCredential{ID: id, InstallationID: installationID, Key: Secret(get(FieldKey))}
+	default:
+		return nil, fmt.Errorf("unknown kind: %v", c.Type)
+	}
+
+	return c, nil
+}
+
 func (c *Credential) Name() string {
 	return c.AppName
 }
@@ -50,12 +266,69 @@ func (c *Credential) InstallationID() int64 {
 	return c.AppCredential.InstallationID
 }
 
-func (c *Credential) Base64PrivateKey() string {
-	return c.AppCredential.Key
+// PrivateKey returns the PEM encoded private key of the GitHub App.
+func (c *Credential) PrivateKey() ([]byte, error) {
+	if c.AppCredential.privateKey != "" {
+		return []byte(c.AppCredential.privateKey.Value()), nil
+	}
+
+	key, err := github.DecodePrivateKey([]byte(c.AppCredential.Key.Value()))
+	if err != nil {
+		return nil, fmt.Errorf("credential %v: %w", c.AppName, err)
+	}
+
+	return key, nil
+}
+
+func (c *Credential) BaseURL() string {
+	return c.Endpoint.BaseURL
+}
+
+func (c *Credential) UploadURL() string {
+	return c.Endpoint.UploadURL
 }
 
 func (c *Credential) Token() string {
-	return c.PAT.Token
+	return c.PAT.Token.Value()
+}
+
+// String describes the credential without revealing its secrets.
+func (c Credential) String() string {
+	s := fmt.Sprintf("%v (%v", c.AppName, c.Type)
+	if c.AppCredential != nil {
+		s += fmt.Sprintf(", %v", c.AppCredential)
+	}
+	if c.Endpoint.BaseURL != "" {
+		s += fmt.Sprintf(", baseURL %v", c.Endpoint.BaseURL)
+	}
+
+	return s + ")"
+}
+
+func (c Credential) GoString() string {
+	return "exporter.Credential{" + c.String() + "}"
+}
+
+func (a AppCredential) String() string {
+	return fmt.Sprintf("appId %v, installationId %v", a.ID, a.InstallationID)
+}
+
+func (a AppCredential) GoString() string {
+	return "exporter.AppCredential{" + a.String() + "}"
+}
+
+func (p PAT) String() string {
+	return "token " + p.Token.String()
+}
+
+func (p PAT) GoString() string {
+	return "exporter.PAT{" + p.String() + "}"
+}
+
+// DiscoversInstallations reports whether the credential is a GitHub App
+// credential without installation ID, whose installations are discovered.
+func (c *Credential) DiscoversInstallations() bool {
+	return c.Type == GitHubApp && c.AppCredential != nil && c.AppCredential.InstallationID == 0
 }
 
 func (c *Credential) Kind() string {
@@ -64,28 +337,151 @@ func (c *Credential) Kind() string {
 
 const FileCredentialFileName = "credentials.yml"
 
+// CredentialsPath is the path of the credentials file or directory.
+// Relative paths are resolved against the current working directory.
+//
+// A directory is expected to contain one file per credential, e.g. a
+// mounted Kubernetes Secret volume. The file name without extension is
+// used as the credential name and the file holds a single credential.
+type CredentialsPath string
+
+// CredentialsReloadInterval is how often FileCredentialSource checks
+// the credentials file for changes. Zero disables the periodic checks.
+type CredentialsReloadInterval int64
+
 type FileCredentialSource struct {
 	Data map[string]*Credential
+
+	fs     *afero.Afero
+	path   string
+	reload time.Duration
+	log    logger.Logger
+	mtx    sync.Mutex
 }
 
-func NewFileCredentialSource(fs *afero.Afero) (*FileCredentialSource, error) {
-	cwd, err := os.Getwd()
+func NewFileCredentialSource(
+	fs *afero.Afero,
+	path *CredentialsPath,
+	reload *CredentialsReloadInterval,
+	log logger.Logger,
+) (*FileCredentialSource, error) {
+	p := string(*path)
+	if !filepath.IsAbs(p) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		p = filepath.Join(cwd, p)
+	}
+
+	data, err := readCredentials(fs, p)
 	if err != nil {
 		return nil, err
 	}
 
-	b, err := fs.ReadFile(filepath.Join(cwd, FileCredentialFileName))
+	return &FileCredentialSource{Data: data, fs: fs, path: p, reload: time.Duration(*reload), log: log}, nil
+}
+
+func readCredentials(fs *afero.Afero, path string) (map[string]*Credential, error) {
+	isDir, err := fs.IsDir(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var src FileCredentialSource
-	err = yaml.Unmarshal(b, &src)
+	var data map[string]*Credential
+	dir := filepath.Dir(path)
+
+	if isDir {
+		data, err = readCredentialDir(fs, path)
+		if err != nil {
+			return nil, err
+		}
+		dir = path
+	} else {
+		b, err := fs.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var src FileCredentialSource
+		err = yaml.Unmarshal(b, &src)
+		if err != nil {
+			return nil, err
+		}
+		data = src.Data
+	}
+
+	if err := validateCredentials(fs, dir, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// validateCredentials validates the credentials in the order of their names.
+// Relative key file paths are resolved against given directory.
+func validateCredentials(fs *afero.Afero, dir string, data map[string]*Credential) error {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := data[name]
+		if c.AppCredential != nil && c.KeyFile != "" && !filepath.IsAbs(c.KeyFile) {
+			c.KeyFile = filepath.Join(dir, c.KeyFile)
+		}
+
+		if err := c.Validate(fs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readCredentialDir(fs *afero.Afero, dir string) (map[string]*Credential, error) {
+	entries, err := fs.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
 
-	return &src, nil
+	data := make(map[string]*Credential)
+
+	for _, e := range entries {
+		// Skip hidden files, including the ..data
+		// and timestamped directories of projected volumes.
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		p := filepath.Join(dir, e.Name())
+		// Stat follows symlinks which projected volumes consist of.
+		if isDir, err := fs.IsDir(p); err != nil || isDir {
+			continue
+		}
+
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		if _, ok := data[name]; ok {
+			return nil, fmt.Errorf("credential %v: defined more than once in %v", name, dir)
+		}
+
+		b, err := fs.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		var c Credential
+		if err := yaml.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("credential %v: %w", name, err)
+		}
+
+		c.AppName = name
+		data[name] = &c
+	}
+
+	return data, nil
 }
 
 func (src *FileCredentialSource) UnmarshalYAML(root *yaml.Node) error {
@@ -105,6 +501,9 @@ func (src *FileCredentialSource) UnmarshalYAML(root *yaml.Node) error {
 }
 
 func (src *FileCredentialSource) Credentials() []*Credential {
+	src.mtx.Lock()
+	defer src.mtx.Unlock()
+
 	credentials := make([]*Credential, 0, len(src.Data))
 	for _, c := range src.Data {
 		credentials = append(credentials, c)
@@ -112,3 +511,56 @@ func (src *FileCredentialSource) Credentials() []*Credential {
 
 	return credentials
 }
+
+// Watch re-reads the credentials on SIGHUP and every reload interval and
+// calls update whenever they have changed. If the credentials cannot be
+// read then the previous credentials are kept.
+func (src *FileCredentialSource) Watch(ctx context.Context, update func([]*Credential)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if src.reload > 0 {
+		ticker := time.NewTicker(src.reload)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-tick:
+		}
+
+		changed, err := src.Reload()
+		if err != nil {
+			src.log.Errorw("reloading credentials failed, keeping previous credentials", "path", src.path, "error", err)
+			continue
+		}
+
+		if changed {
+			update(src.Credentials())
+		}
+	}
+}
+
+// Reload re-reads the credentials and reports whether they have changed.
+func (src *FileCredentialSource) Reload() (bool, error) {
+	data, err := readCredentials(src.fs, src.path)
+	if err != nil {
+		return false, err
+	}
+
+	src.mtx.Lock()
+	defer src.mtx.Unlock()
+
+	if reflect.DeepEqual(data, src.Data) {
+		return false, nil
+	}
+	src.Data = data
+
+	return true, nil
+}
@@ -0,0 +1,156 @@
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// EnvCredentialPrefix is the prefix of the environment variables
+// EnvCredentialSource reads the credentials from. It differs from
+// the prefix of the configuration variables so that they cannot clash.
+const EnvCredentialPrefix = "GHRLE_CREDENTIAL_"
+
+const (
+	envSuffixType           = "_TYPE"
+	envSuffixToken          = "_TOKEN"
+	envSuffixAppID          = "_APP_ID"
+	envSuffixInstallationID = "_INSTALLATION_ID"
+	envSuffixKey            = "_KEY"
+	envSuffixKeyFile        = "_KEY_FILE"
+	envSuffixBaseURL        = "_BASE_URL"
+	envSuffixUploadURL      = "_UPLOAD_URL"
+)
+
+var envSuffixes = []string{
+	envSuffixType,
+	envSuffixToken,
+	envSuffixAppID,
+	envSuffixInstallationID,
+	envSuffixKey,
+	envSuffixKeyFile,
+	envSuffixBaseURL,
+	envSuffixUploadURL,
+}
+
+// EnvCredentialSource reads credentials from environment variables.
+// A credential is defined by GHRLE_CREDENTIAL_<NAME>_TYPE and the rest
+// of its properties are read from the variables with the same <NAME>:
+//
+//	GHRLE_CREDENTIAL_<NAME>_TOKEN            token of gh-pat credential
+//	GHRLE_CREDENTIAL_<NAME>_APP_ID           app ID of gh-app credential
+//	GHRLE_CREDENTIAL_<NAME>_INSTALLATION_ID  installation ID of gh-app credential
+//	GHRLE_CREDENTIAL_<NAME>_KEY              private key (PEM or base64 encoded PEM) of gh-app credential
+//	GHRLE_CREDENTIAL_<NAME>_KEY_FILE         file with the private key of gh-app credential
+//	GHRLE_CREDENTIAL_<NAME>_BASE_URL         API URL of GitHub Enterprise Server
+//	GHRLE_CREDENTIAL_<NAME>_UPLOAD_URL       upload URL of GitHub Enterprise Server
+//
+// The credential name is <NAME> in lower case with underscores replaced
+// by dashes, e.g. GHRLE_CREDENTIAL_MY_APP_TYPE defines my-app. <NAME>
+// must not end with one of the suffixes above as e.g. the variables of
+// MY_APP_KEY and the key of MY_APP could not be told apart.
+type EnvCredentialSource struct {
+	Data map[string]*Credential
+}
+
+func NewEnvCredentialSource(environ []string, fs *afero.Afero) (*EnvCredentialSource, error) {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+
+	src := &EnvCredentialSource{Data: make(map[string]*Credential)}
+
+	for k, v := range env {
+		if !strings.HasPrefix(k, EnvCredentialPrefix) || !strings.HasSuffix(k, envSuffixType) {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(k, envSuffixType)
+		id := strings.TrimPrefix(prefix, EnvCredentialPrefix)
+		if id == "" {
+			continue
+		}
+
+		name := strings.ReplaceAll(strings.ToLower(id), "_", "-")
+		for _, suffix := range envSuffixes {
+			if strings.HasSuffix(id, suffix) {
+				return nil, fmt.Errorf("credential %v: %v must not end with %v", name, k, suffix+envSuffixType)
+			}
+		}
+
+		c, err := readEnvCredential(name, Type(v), prefix, env, fs)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := src.Data[name]; ok {
+			return nil, fmt.Errorf("credential %v: defined more than once", name)
+		}
+
+		src.Data[name] = c
+	}
+
+	return src, nil
+}
+
+func readEnvCredential(name string, t Type, prefix string, env map[string]string, fs *afero.Afero) (*Credential, error) {
+	c := &Credential{
+		Type:     t,
+		AppName:  name,
+		Endpoint: Endpoint{BaseURL: env[prefix+envSuffixBaseURL], UploadURL: env[prefix+envSuffixUploadURL]},
+	}
+
+	switch t {
+	case GitHubPAT:
+		c.PAT = &PAT{Token: Secret(env[prefix+envSuffixToken])}
+	case GitHubApp:
+		id, err := parseEnvInt(env, prefix+envSuffixAppID)
+		if err != nil {
+			return nil, fmt.Errorf("credential %v: %w", name, err)
+		}
+
+		// Missing installation ID discovers all installations.
+		var installationID int64
+		if env[prefix+envSuffixInstallationID] != "" {
+			installationID, err = parseEnvInt(env, prefix+envSuffixInstallationID)
+			if err != nil {
+				return nil, fmt.Errorf("credential %v: %w", name, err)
+			}
+		}
+
+		c.AppCredential = &AppCredential{
+			ID:             id,
+			InstallationID: installationID,
+			Key:            Secret(env[prefix+envSuffixKey]),
+			KeyFile:        env[prefix+envSuffixKeyFile],
+		}
+	}
+
+	if err := c.Validate(fs); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func parseEnvInt(env map[string]string, name string) (int64, error) {
+	i, err := strconv.ParseInt(env[name], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v: %w", name, err)
+	}
+
+	return i, nil
+}
+
+func (src *EnvCredentialSource) Credentials() []*Credential {
+	credentials := make([]*Credential, 0, len(src.Data))
+	for _, c := range src.Data {
+		credentials = append(credentials, c)
+	}
+
+	return credentials
+}
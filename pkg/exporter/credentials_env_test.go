@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvCredentialSource(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reads credentials from environment variables", func(t *testing.T) {
+		fs := NewTestFS(t)
+		fs.WriteFile("/secrets/key.pem", []byte(testKey), 0600)
+
+		var src CredentialSource
+		src, err := NewEnvCredentialSource([]string{
+			"GHRLE_CREDENTIAL_MY_APP_ONE_TYPE=gh-app",
+			"GHRLE_CREDENTIAL_MY_APP_ONE_APP_ID=1",
+			"GHRLE_CREDENTIAL_MY_APP_ONE_INSTALLATION_ID=2",
+			"GHRLE_CREDENTIAL_MY_APP_ONE_KEY=" + testBase64Key,
+			"GHRLE_CREDENTIAL_MY_APP_TWO_TYPE=gh-pat",
+			"GHRLE_CREDENTIAL_MY_APP_TWO_TOKEN=token",
+			"GHRLE_CREDENTIAL_MY_APP_THREE_TYPE=gh-app",
+			"GHRLE_CREDENTIAL_MY_APP_THREE_APP_ID=3",
+			"GHRLE_CREDENTIAL_MY_APP_THREE_INSTALLATION_ID=4",
+			"GHRLE_CREDENTIAL_MY_APP_THREE_KEY_FILE=/secrets/key.pem",
+			"GHRLE_LOG_LEVEL=debug",
+			"GHRLE_CREDENTIALS_SOURCE=env",
+			"HOME=/root",
+		}, fs)
+
+		if assert.NoError(t, err) {
+			assert.Len(t, src.Credentials(), 3)
+		}
+
+		data := src.(*EnvCredentialSource).Data
+		assert.Equal(t, GitHubApp, data["my-app-one"].Type)
+		assert.Equal(t, int64(1), data["my-app-one"].ID())
+		assert.Equal(t, int64(2), data["my-app-one"].InstallationID())
+		assert.Equal(t, testBase64Key, data["my-app-one"].Key.Value())
+		assert.Equal(t, &Credential{
+			Type:    GitHubPAT,
+			AppName: "my-app-two",
+			PAT:     &PAT{Token: "token"},
+		}, data["my-app-two"])
+		assert.Equal(t, "/secrets/key.pem", data["my-app-three"].KeyFile)
+		key, _ := data["my-app-three"].PrivateKey()
+		assert.Equal(t, strings.TrimSpace(testKey), string(key))
+	})
+
+	t.Run("returns error with unknown credential type", func(t *testing.T) {
+		src, err := NewEnvCredentialSource([]string{"GHRLE_CREDENTIAL_MY_APP_TYPE=gh-oauth"}, NewTestFS(t))
+
+		assert.Nil(t, src)
+		assert.EqualError(t, err, "credential my-app: unknown kind: gh-oauth")
+	})
+
+	t.Run("returns error with malformed app ID", func(t *testing.T) {
+		src, err := NewEnvCredentialSource([]string{
+			"GHRLE_CREDENTIAL_MY_APP_TYPE=gh-app",
+			"GHRLE_CREDENTIAL_MY_APP_APP_ID=one",
+			"GHRLE_CREDENTIAL_MY_APP_INSTALLATION_ID=2",
+		}, NewTestFS(t))
+
+		assert.Nil(t, src)
+		assert.ErrorContains(t, err, "credential my-app: invalid GHRLE_CREDENTIAL_MY_APP_APP_ID")
+	})
+
+	t.Run("returns error if key file does not exist", func(t *testing.T) {
+		src, err := NewEnvCredentialSource([]string{
+			"GHRLE_CREDENTIAL_MY_APP_TYPE=gh-app",
+			"GHRLE_CREDENTIAL_MY_APP_APP_ID=1",
+			"GHRLE_CREDENTIAL_MY_APP_INSTALLATION_ID=2",
+			"GHRLE_CREDENTIAL_MY_APP_KEY_FILE=/does/not/exist",
+		}, NewTestFS(t))
+
+		assert.Nil(t, src)
+		assert.ErrorContains(t, err, "credential my-app:")
+	})
+
+	t.Run("returns error if name ends with variable suffix", func(t *testing.T) {
+		src, err := NewEnvCredentialSource([]string{
+			"GHRLE_CREDENTIAL_MY_APP_KEY_TYPE=gh-pat",
+			"GHRLE_CREDENTIAL_MY_APP_KEY_TOKEN=token",
+		}, NewTestFS(t))
+
+		assert.Nil(t, src)
+		assert.EqualError(t, err, "credential my-app-key: GHRLE_CREDENTIAL_MY_APP_KEY_TYPE must not end with _KEY_TYPE")
+	})
+}
@@ -0,0 +1,208 @@
+package exporter
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// DefaultKubernetesSelector is the default label selector
+// of the Secrets KubernetesCredentialSource reads.
+const DefaultKubernetesSelector = "gh-rate-limit-exporter/credential=true"
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// KubernetesCredentialSource reads credentials from the Kubernetes Secrets
+// matching the label selector. Every Secret holds a single credential in
+// the type, token, appId, installationId and key data keys (see the Field
+// constants). The credential is named after the Secret, or after
+// namespace/name if Secrets are read from all namespaces. Malformed
+// Secrets are logged and skipped.
+type KubernetesCredentialSource struct {
+	Data map[string]*Credential
+
+	client    kubernetes.Interface
+	namespace string
+	selector  string
+	log       logger.Logger
+	mtx       sync.Mutex
+}
+
+// NewKubernetesClient returns a client for the cluster of given kubeconfig
+// file. Empty kubeconfig results in the in-cluster configuration.
+func NewKubernetesClient(kubeconfig string) (kubernetes.Interface, error) {
+	var cfg *rest.Config
+	var err error
+	if kubeconfig == "" {
+		cfg, err = rest.InClusterConfig()
+	} else {
+		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(cfg)
+}
+
+// InClusterNamespace returns the namespace the exporter is running in
+// or empty string if the exporter is not running in a cluster.
+func InClusterNamespace() string {
+	b, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// NewKubernetesCredentialSource lists the credential Secrets in the namespace.
+// Empty namespace lists the Secrets in all namespaces.
+func NewKubernetesCredentialSource(
+	client kubernetes.Interface,
+	namespace string,
+	selector string,
+	log logger.Logger,
+) (*KubernetesCredentialSource, error) {
+	if _, err := k8slabels.Parse(selector); err != nil {
+		return nil, err
+	}
+
+	src := &KubernetesCredentialSource{client: client, namespace: namespace, selector: selector, log: log}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	list, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]*corev1.Secret, 0, len(list.Items))
+	for i := range list.Items {
+		secrets = append(secrets, &list.Items[i])
+	}
+	src.Data = src.credentials(secrets)
+
+	return src, nil
+}
+
+func (src *KubernetesCredentialSource) credentials(secrets []*corev1.Secret) map[string]*Credential {
+	data := make(map[string]*Credential, len(secrets))
+	for _, s := range secrets {
+		name := s.Name
+		if src.namespace == "" {
+			name = s.Namespace + "/" + s.Name
+		}
+
+		c, err := credentialFromSecret(name, s)
+		if err != nil {
+			src.log.Errorw("skipping malformed credential secret", "namespace", s.Namespace, "secret", s.Name, "error", err)
+			continue
+		}
+
+		data[name] = c
+	}
+
+	return data
+}
+
+func credentialFromSecret(name string, s *corev1.Secret) (*Credential, error) {
+	c, err := credentialFromFields(name, func(key string) string {
+		return strings.TrimSpace(string(s.Data[key]))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(nil); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (src *KubernetesCredentialSource) Credentials() []*Credential {
+	src.mtx.Lock()
+	defer src.mtx.Unlock()
+
+	credentials := make([]*Credential, 0, len(src.Data))
+	for _, c := range src.Data {
+		credentials = append(credentials, c)
+	}
+
+	return credentials
+}
+
+// Watch watches the credential Secrets and calls update
+// whenever a credential is added, changed or removed.
+func (src *KubernetesCredentialSource) Watch(ctx context.Context, update func([]*Credential)) {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		src.client,
+		0,
+		informers.WithNamespace(src.namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) { o.LabelSelector = src.selector }),
+	)
+	secrets := factory.Core().V1().Secrets()
+	informer := secrets.Informer()
+
+	var syncMtx sync.Mutex
+	var synced atomic.Bool
+
+	resync := func() {
+		// The store is filled one Secret at a time during the initial
+		// sync, so don't mistake a partial list for removed Secrets.
+		if !synced.Load() {
+			return
+		}
+
+		syncMtx.Lock()
+		defer syncMtx.Unlock()
+
+		list, err := secrets.Lister().List(k8slabels.Everything())
+		if err != nil {
+			src.log.Errorw("listing credential secrets failed", "error", err)
+			return
+		}
+
+		data := src.credentials(list)
+
+		src.mtx.Lock()
+		changed := !reflect.DeepEqual(data, src.Data)
+		src.Data = data
+		src.mtx.Unlock()
+
+		if changed {
+			update(src.Credentials())
+		}
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { resync() },
+		UpdateFunc: func(any, any) { resync() },
+		DeleteFunc: func(any) { resync() },
+	})
+
+	factory.Start(ctx.Done())
+	if cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		synced.Store(true)
+		resync()
+	}
+
+	<-ctx.Done()
+	factory.Shutdown()
+}
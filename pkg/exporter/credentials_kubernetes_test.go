@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newSecret(namespace, name string, data map[string]string) *corev1.Secret {
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{"gh-rate-limit-exporter/credential": "true"},
+		},
+		Data: make(map[string][]byte),
+	}
+	for k, v := range data {
+		s.Data[k] = []byte(v)
+	}
+
+	return s
+}
+
+func TestKubernetesCredentialSource(t *testing.T) {
+	t.Parallel()
+
+	appSecret := newSecret("ci", "my-app-one", map[string]string{
+		"type":           "gh-app",
+		"appId":          "1",
+		"installationId": "2",
+		"key":            testKey,
+	})
+	patSecret := newSecret("ci", "my-app-two", map[string]string{"type": "gh-pat", "token": "token\n"})
+
+	t.Run("reads credentials from labelled secrets", func(t *testing.T) {
+		unlabelled := newSecret("ci", "unrelated", map[string]string{"type": "gh-pat"})
+		unlabelled.Labels = nil
+		client := fake.NewSimpleClientset(appSecret, patSecret, unlabelled)
+
+		var src CredentialSource
+		src, err := NewKubernetesCredentialSource(client, "ci", DefaultKubernetesSelector, &logger.NopLogger{})
+
+		if assert.NoError(t, err) {
+			assert.Len(t, src.Credentials(), 2)
+		}
+
+		data := src.(*KubernetesCredentialSource).Data
+		assert.Equal(t, GitHubApp, data["my-app-one"].Type)
+		assert.Equal(t, int64(1), data["my-app-one"].ID())
+		assert.Equal(t, int64(2), data["my-app-one"].InstallationID())
+		assert.Equal(t, "token", data["my-app-two"].Token())
+	})
+
+	t.Run("names credentials after namespace and secret when reading all namespaces", func(t *testing.T) {
+		client := fake.NewSimpleClientset(patSecret)
+
+		src, err := NewKubernetesCredentialSource(client, "", DefaultKubernetesSelector, &logger.NopLogger{})
+
+		if assert.NoError(t, err) {
+			assert.Contains(t, src.Data, "ci/my-app-two")
+		}
+	})
+
+	t.Run("skips malformed secrets", func(t *testing.T) {
+		malformed := newSecret("ci", "malformed", map[string]string{"type": "gh-app", "appId": "one"})
+		client := fake.NewSimpleClientset(patSecret, malformed)
+
+		src, err := NewKubernetesCredentialSource(client, "ci", DefaultKubernetesSelector, &logger.NopLogger{})
+
+		if assert.NoError(t, err) {
+			assert.Len(t, src.Credentials(), 1)
+		}
+	})
+
+	t.Run("returns error with invalid selector", func(t *testing.T) {
+		src, err := NewKubernetesCredentialSource(fake.NewSimpleClientset(), "ci", "a b c", &logger.NopLogger{})
+
+		assert.Nil(t, src)
+		assert.Error(t, err)
+	})
+
+	t.Run("watch notifies about added, changed and removed secrets", func(t *testing.T) {
+		client := fake.NewSimpleClientset(patSecret)
+		src, err := NewKubernetesCredentialSource(client, "ci", DefaultKubernetesSelector, &logger.NopLogger{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		updates := make(chan []*Credential, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			src.Watch(ctx, func(c []*Credential) { updates <- c })
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		next := func() []*Credential {
+			select {
+			case c := <-updates:
+				return c
+			case <-time.After(5 * time.Second):
+				t.Fatal("credentials were not updated")
+				return nil
+			}
+		}
+
+		secrets := client.CoreV1().Secrets("ci")
+
+		secrets.Create(ctx, appSecret, metav1.CreateOptions{})
+		assert.Len(t, next(), 2)
+
+		rotated := patSecret.DeepCopy()
+		rotated.Data["token"] = []byte("rotated")
+		secrets.Update(ctx, rotated, metav1.UpdateOptions{})
+		for _, c := range next() {
+			if c.Name() == "my-app-two" {
+				assert.Equal(t, "rotated", c.Token())
+			}
+		}
+
+		secrets.Delete(ctx, "my-app-one", metav1.DeleteOptions{})
+		assert.Len(t, next(), 1)
+	})
+}
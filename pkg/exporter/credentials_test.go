@@ -1,13 +1,21 @@
 package exporter
 
 import (
+	"context"
 	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func Cwd(t *testing.T) string {
@@ -29,9 +37,26 @@ func NewTestFS(t *testing.T) *afero.Afero {
 	return fs
 }
 
+func defaultPath() *CredentialsPath {
+	p := CredentialsPath(FileCredentialFileName)
+
+	return &p
+}
+
+func noReload() *CredentialsReloadInterval {
+	i := CredentialsReloadInterval(0)
+
+	return &i
+}
+
 //go:embed testdata/test-credentials.yml
 var credentials string
 
+//go:embed testdata/test-key.pem
+var testKey string
+
+var testBase64Key = base64.StdEncoding.EncodeToString([]byte(testKey))
+
 func writeCredentials(b []byte, t *testing.T, fs *afero.Afero) {
 	fs.WriteFile(filepath.Join(Cwd(t), FileCredentialFileName), b, 0600)
 }
@@ -44,7 +69,7 @@ func TestFileCredentialSource(t *testing.T) {
 		writeCredentials([]byte(credentials), t, fs)
 
 		var src CredentialSource
-		src, err := NewFileCredentialSource(fs)
+		src, err := NewFileCredentialSource(fs, defaultPath(), noReload(), &logger.NopLogger{})
 		credentials := src.Credentials()
 
 		assert.NoError(t, err)
@@ -55,7 +80,7 @@ func TestFileCredentialSource(t *testing.T) {
 		fs := NewTestFS(t)
 		writeCredentials([]byte("..."), t, fs)
 
-		src, err := NewFileCredentialSource(fs)
+		src, err := NewFileCredentialSource(fs, defaultPath(), noReload(), &logger.NopLogger{})
 
 		assert.Nil(t, src)
 		assert.EqualError(t, err, "yaml: did not find expected node content")
@@ -64,7 +89,7 @@ func TestFileCredentialSource(t *testing.T) {
 	t.Run("returns error if credential file does not exist", func(t *testing.T) {
 		fs := NewTestFS(t)
 
-		src, err := NewFileCredentialSource(fs)
+		src, err := NewFileCredentialSource(fs, defaultPath(), noReload(), &logger.NopLogger{})
 
 		assert.Nil(t, src)
 		if assert.Error(t, err) {
@@ -75,6 +100,118 @@ func TestFileCredentialSource(t *testing.T) {
 	})
 }
 
+func TestFileCredentialSourceWithPath(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reads credentials from explicit path", func(t *testing.T) {
+		fs := NewTestFS(t)
+		fs.WriteFile("/etc/ghrle/creds.yml", []byte(credentials), 0600)
+		path := CredentialsPath("/etc/ghrle/creds.yml")
+
+		src, err := NewFileCredentialSource(fs, &path, noReload(), &logger.NopLogger{})
+
+		assert.NoError(t, err)
+		assert.Len(t, src.Credentials(), 2)
+	})
+
+	t.Run("merges credentials from directory with one file per credential", func(t *testing.T) {
+		fs := NewTestFS(t)
+		fs.WriteFile("/secrets/my-app-one.yml", []byte("type: gh-app\nappId: 1\ninstallationId: 2\nkey: "+testBase64Key+"\n"), 0600)
+		fs.WriteFile("/secrets/my-app-two", []byte("type: gh-pat\ntoken: token\n"), 0600)
+		fs.WriteFile("/secrets/..data/my-app-two", []byte("type: gh-pat\ntoken: token\n"), 0600)
+		fs.WriteFile("/secrets/.hidden", []byte("..."), 0600)
+		path := CredentialsPath("/secrets")
+
+		src, err := NewFileCredentialSource(fs, &path, noReload(), &logger.NopLogger{})
+
+		assert.NoError(t, err)
+		assert.Len(t, src.Data, 2)
+		assert.Equal(t, "my-app-one", src.Data["my-app-one"].Name())
+		assert.Equal(t, int64(1), src.Data["my-app-one"].ID())
+		assert.Equal(t, "token", src.Data["my-app-two"].Token())
+	})
+
+	t.Run("returns error with credential defined twice in directory", func(t *testing.T) {
+		fs := NewTestFS(t)
+		fs.WriteFile("/secrets/my-app.yml", []byte("type: gh-pat\ntoken: token\n"), 0600)
+		fs.WriteFile("/secrets/my-app.yaml", []byte("type: gh-pat\ntoken: token\n"), 0600)
+		path := CredentialsPath("/secrets")
+
+		src, err := NewFileCredentialSource(fs, &path, noReload(), &logger.NopLogger{})
+
+		assert.Nil(t, src)
+		assert.EqualError(t, err, "credential my-app: defined more than once in /secrets")
+	})
+
+	t.Run("returns error with malformed credential in directory", func(t *testing.T) {
+		fs := NewTestFS(t)
+		fs.WriteFile("/secrets/my-app", []byte("..."), 0600)
+		path := CredentialsPath("/secrets")
+
+		src, err := NewFileCredentialSource(fs, &path, noReload(), &logger.NopLogger{})
+
+		assert.Nil(t, src)
+		assert.EqualError(t, err, "credential my-app: yaml: did not find expected node content")
+	})
+}
+
+func TestFileCredentialSourceReload(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports unchanged credentials", func(t *testing.T) {
+		fs := NewTestFS(t)
+		writeCredentials([]byte(credentials), t, fs)
+		src, _ := NewFileCredentialSource(fs, defaultPath(), noReload(), &logger.NopLogger{})
+
+		changed, err := src.Reload()
+
+		assert.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("keeps previous credentials if reload fails", func(t *testing.T) {
+		fs := NewTestFS(t)
+		writeCredentials([]byte(credentials), t, fs)
+		src, _ := NewFileCredentialSource(fs, defaultPath(), noReload(), &logger.NopLogger{})
+		writeCredentials([]byte("..."), t, fs)
+
+		changed, err := src.Reload()
+
+		assert.Error(t, err)
+		assert.False(t, changed)
+		assert.Len(t, src.Credentials(), 2)
+	})
+
+	t.Run("watch notifies about changed credentials", func(t *testing.T) {
+		fs := NewTestFS(t)
+		writeCredentials([]byte(credentials), t, fs)
+		reload := CredentialsReloadInterval(10 * time.Millisecond)
+		src, _ := NewFileCredentialSource(fs, defaultPath(), &reload, &logger.NopLogger{})
+
+		updates := make(chan []*Credential, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			src.Watch(ctx, func(c []*Credential) { updates <- c })
+		}()
+
+		writeCredentials([]byte("my-app-three:\n  type: gh-pat\n  token: token\n"), t, fs)
+
+		select {
+		case c := <-updates:
+			if assert.Len(t, c, 1) {
+				assert.Equal(t, "my-app-three", c[0].Name())
+			}
+		case <-time.After(time.Second):
+			t.Error("credentials were not reloaded")
+		}
+
+		cancel()
+		<-done
+	})
+}
+
 func TestCredential(t *testing.T) {
 	find := func(name string, credentials []*Credential) *Credential {
 		for _, c := range credentials {
@@ -92,7 +229,10 @@ func TestCredential(t *testing.T) {
 		assert.Equal(t, "my-app-one", c.Name())
 		assert.Equal(t, int64(1), c.ID())
 		assert.Equal(t, int64(2), c.InstallationID())
-		assert.Equal(t, "key", c.Base64PrivateKey())
+		assert.Equal(t, testBase64Key, c.Key.Value())
+		key, err := c.PrivateKey()
+		assert.NoError(t, err)
+		assert.Equal(t, strings.TrimSpace(testKey), string(key))
 		assert.Nil(t, c.PAT)
 	}
 
@@ -109,7 +249,7 @@ func TestCredential(t *testing.T) {
 		writeCredentials([]byte(credentials), t, fs)
 
 		var src CredentialSource
-		src, err := NewFileCredentialSource(fs)
+		src, err := NewFileCredentialSource(fs, defaultPath(), noReload(), &logger.NopLogger{})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -120,3 +260,138 @@ func TestCredential(t *testing.T) {
 		assertIsMyAppTwo(t, find("my-app-two", credentials))
 	})
 }
+
+func TestCredentialValidate(t *testing.T) {
+	app := func(a *AppCredential) *Credential {
+		return &Credential{Type: GitHubApp, AppName: "my-app", AppCredential: a}
+	}
+
+	t.Run("loads private key from key file", func(t *testing.T) {
+		fs := NewTestFS(t)
+		fs.WriteFile("/keys/my-app.pem", []byte(testKey), 0600)
+		c := app(&AppCredential{ID: 1, InstallationID: 2, KeyFile: "/keys/my-app.pem"})
+
+		assert.NoError(t, c.Validate(fs))
+		key, err := c.PrivateKey()
+		assert.NoError(t, err)
+		assert.Equal(t, strings.TrimSpace(testKey), string(key))
+	})
+
+	t.Run("resolves relative key file against credentials directory", func(t *testing.T) {
+		fs := NewTestFS(t)
+		fs.WriteFile("/etc/ghrle/my-app.pem", []byte(testKey), 0600)
+		fs.WriteFile("/etc/ghrle/creds.yml", []byte("my-app:\n  type: gh-app\n  appId: 1\n  installationId: 2\n  keyFile: my-app.pem\n"), 0600)
+		path := CredentialsPath("/etc/ghrle/creds.yml")
+
+		src, err := NewFileCredentialSource(fs, &path, noReload(), &logger.NopLogger{})
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, "/etc/ghrle/my-app.pem", src.Data["my-app"].KeyFile)
+		}
+	})
+
+	t.Run("rejects key together with key file", func(t *testing.T) {
+		c := app(&AppCredential{ID: 1, InstallationID: 2, Key: Secret(testBase64Key), KeyFile: "/keys/my-app.pem"})
+
+		assert.EqualError(t, c.Validate(NewTestFS(t)), "credential my-app: only one of key and keyFile may be set")
+	})
+
+	t.Run("rejects malformed key", func(t *testing.T) {
+		c := app(&AppCredential{ID: 1, InstallationID: 2, Key: "key"})
+
+		assert.EqualError(t, c.Validate(nil), "credential my-app: private key is neither PEM nor base64 encoded PEM")
+	})
+
+	t.Run("rejects missing app id", func(t *testing.T) {
+		c := app(&AppCredential{InstallationID: 2, Key: Secret(testBase64Key)})
+
+		assert.EqualError(t, c.Validate(nil), "credential my-app: appId must be set")
+	})
+
+	t.Run("accepts missing installation id to discover installations", func(t *testing.T) {
+		c := app(&AppCredential{ID: 1, Key: Secret(testBase64Key)})
+
+		assert.NoError(t, c.Validate(nil))
+		assert.True(t, c.DiscoversInstallations())
+	})
+
+	t.Run("rejects negative installation id", func(t *testing.T) {
+		c := app(&AppCredential{ID: 1, InstallationID: -1, Key: Secret(testBase64Key)})
+
+		assert.EqualError(t, c.Validate(nil), "credential my-app: installationId must not be negative")
+	})
+
+	t.Run("reads GitHub Enterprise Server URLs", func(t *testing.T) {
+		fs := NewTestFS(t)
+		writeCredentials([]byte("my-pat:\n  type: gh-pat\n  token: token\n  baseURL: https://ghes.example.com/api/v3/\n"), t, fs)
+
+		src, err := NewFileCredentialSource(fs, defaultPath(), noReload(), &logger.NopLogger{})
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, "https://ghes.example.com/api/v3/", src.Data["my-pat"].BaseURL())
+			assert.Empty(t, src.Data["my-pat"].UploadURL())
+		}
+	})
+
+	t.Run("rejects relative base URL", func(t *testing.T) {
+		c := &Credential{Type: GitHubPAT, AppName: "my-pat", PAT: &PAT{Token: "token"}, Endpoint: Endpoint{BaseURL: "ghes.example.com"}}
+
+		assert.EqualError(t, c.Validate(nil), "credential my-pat: invalid baseURL: ghes.example.com is not an absolute http(s) URL")
+	})
+
+	t.Run("rejects upload URL without base URL", func(t *testing.T) {
+		c := &Credential{Type: GitHubPAT, AppName: "my-pat", PAT: &PAT{Token: "token"}, Endpoint: Endpoint{UploadURL: "https://ghes.example.com/api/uploads/"}}
+
+		assert.EqualError(t, c.Validate(nil), "credential my-pat: uploadURL requires baseURL")
+	})
+
+	t.Run("accepts empty token", func(t *testing.T) {
+		c := &Credential{Type: GitHubPAT, AppName: "my-pat"}
+
+		assert.NoError(t, c.Validate(nil))
+		assert.Equal(t, "", c.Token())
+	})
+
+	t.Run("fails loading credential file with malformed key", func(t *testing.T) {
+		fs := NewTestFS(t)
+		writeCredentials([]byte("my-app:\n  type: gh-app\n  appId: 1\n  installationId: 2\n  key: key\n"), t, fs)
+
+		_, err := NewFileCredentialSource(fs, defaultPath(), noReload(), &logger.NopLogger{})
+
+		assert.EqualError(t, err, "credential my-app: private key is neither PEM nor base64 encoded PEM")
+	})
+}
+
+func TestSecret(t *testing.T) {
+	const token, key = "ghp_secret-token", "secret-key"
+	credentials := []*Credential{
+		{Type: GitHubPAT, AppName: "my-pat", PAT: &PAT{Token: token}},
+		{Type: GitHubApp, AppName: "my-app", AppCredential: &AppCredential{ID: 1, InstallationID: 2, Key: key, privateKey: key}},
+	}
+
+	for _, c := range credentials {
+		for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+			for _, v := range []any{c, *c, c.PAT, c.AppCredential} {
+				out := fmt.Sprintf(format, v)
+
+				assert.NotContains(t, out, token, format)
+				assert.NotContains(t, out, key, format)
+			}
+		}
+
+		b, err := json.Marshal(c)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(b), token)
+		assert.NotContains(t, string(b), key)
+
+		b, err = yaml.Marshal(c)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(b), token)
+		assert.NotContains(t, string(b), key)
+	}
+
+	assert.Equal(t, "my-pat (gh-pat)", credentials[0].String())
+	assert.Equal(t, "my-app (gh-app, appId 1, installationId 2)", credentials[1].String())
+	assert.Equal(t, token, credentials[0].Token())
+	assert.Equal(t, "", Secret("").String())
+}
@@ -0,0 +1,479 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
+)
+
+// Vault auth methods.
+const (
+	VaultAuthToken      = "token"
+	VaultAuthAppRole    = "approle"
+	VaultAuthKubernetes = "kubernetes"
+)
+
+// VaultConfig configures VaultCredentialSource.
+type VaultConfig struct {
+	// Address of the Vault server, e.g. https://vault.example.com:8200.
+	Address string
+	// Mount of the KV v2 secrets engine. Defaults to "secret".
+	Mount string
+	// Path of a single secret or, if it ends with a slash,
+	// the prefix of the secrets which hold the credentials.
+	Path string
+	// Auth is the auth method, one of token, approle or kubernetes.
+	Auth string
+	// AuthMount is the mount of the auth method.
+	// Defaults to the name of the auth method.
+	AuthMount string
+	// Token of the token auth method.
+	Token string
+	// RoleID and SecretID of the approle auth method. SecretIDFile
+	// takes precedence over SecretID and is re-read on every login.
+	RoleID       string
+	SecretID     string
+	SecretIDFile string
+	// Role and JWT of the kubernetes auth method. JWTFile takes
+	// precedence over JWT and is re-read on every login, so rotated
+	// service account tokens are picked up.
+	Role    string
+	JWT     string
+	JWTFile string
+	// RefreshInterval is how often the secrets are re-read.
+	RefreshInterval time.Duration
+	// HTTPClient defaults to a client with a 30 seconds timeout.
+	HTTPClient *http.Client
+}
+
+// VaultCredentialSource reads credentials from Vault KV v2 secrets. Every
+// secret holds a single credential in the type, token, appId, installationId
+// and key fields and the credential is named after the last path segment of
+// the secret. Malformed secrets under a prefix are logged and skipped. The
+// secrets are re-read every refresh interval and the Vault token is renewed,
+// or the source logs in again, before the token expires.
+type VaultCredentialSource struct {
+	Data map[string]*Credential
+
+	cfg    VaultConfig
+	client *http.Client
+	log    logger.Logger
+	mtx    sync.Mutex
+
+	authMtx   sync.Mutex
+	token     string
+	renewable bool
+	expiresAt time.Time
+}
+
+type (
+	vaultAuth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	}
+
+	vaultResponse struct {
+		Auth *vaultAuth      `json:"auth"`
+		Data json.RawMessage `json:"data"`
+	}
+
+	vaultKVData struct {
+		Data map[string]any `json:"data"`
+	}
+
+	vaultListData struct {
+		Keys []string `json:"keys"`
+	}
+
+	vaultTokenData struct {
+		TTL       int64 `json:"ttl"`
+		Renewable bool  `json:"renewable"`
+	}
+
+	vaultError struct {
+		StatusCode int
+		Errors     []string `json:"errors"`
+	}
+)
+
+func (e *vaultError) Error() string {
+	return fmt.Sprintf("vault: %v %v", e.StatusCode, strings.Join(e.Errors, ", "))
+}
+
+// malformedSecretError is returned if a secret
+// can be read but does not hold a valid credential.
+type malformedSecretError struct {
+	err error
+}
+
+func (e *malformedSecretError) Error() string { return e.err.Error() }
+
+func (e *malformedSecretError) Unwrap() error { return e.err }
+
+func NewVaultCredentialSource(cfg VaultConfig, log logger.Logger) (*VaultCredentialSource, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("vault: address must be set")
+	}
+
+	if cfg.Path == "" {
+		return nil, errors.New("vault: path must be set")
+	}
+
+	if cfg.Mount == "" {
+		cfg.Mount = "secret"
+	}
+
+	if cfg.AuthMount == "" {
+		cfg.AuthMount = cfg.Auth
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	src := &VaultCredentialSource{cfg: cfg, client: client, log: log}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := src.login(ctx); err != nil {
+		return nil, err
+	}
+
+	data, err := src.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	src.Data = data
+
+	return src, nil
+}
+
+func (src *VaultCredentialSource) Credentials() []*Credential {
+	src.mtx.Lock()
+	defer src.mtx.Unlock()
+
+	credentials := make([]*Credential, 0, len(src.Data))
+	for _, c := range src.Data {
+		credentials = append(credentials, c)
+	}
+
+	return credentials
+}
+
+// Watch re-reads the secrets every refresh interval and calls update
+// whenever the credentials have changed. The Vault token is renewed
+// in the meantime. If the secrets cannot be read then the previous
+// credentials are kept.
+func (src *VaultCredentialSource) Watch(ctx context.Context, update func([]*Credential)) {
+	var refresh <-chan time.Time
+	if src.cfg.RefreshInterval > 0 {
+		ticker := time.NewTicker(src.cfg.RefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	for {
+		// Tokens without TTL are never renewed,
+		// so renew is left nil for them.
+		var timer *time.Timer
+		var renew <-chan time.Time
+		if d, ok := src.renewIn(); ok {
+			timer = time.NewTimer(d)
+			renew = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-renew:
+			if err := src.renew(ctx); err != nil {
+				src.log.Errorw("renewing vault token failed", "error", err)
+			}
+			continue
+		case <-refresh:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+
+		data, err := src.read(ctx)
+		if err != nil {
+			src.log.Errorw("reading vault secrets failed, keeping previous credentials", "path", src.cfg.Path, "error", err)
+			continue
+		}
+
+		src.mtx.Lock()
+		changed := !reflect.DeepEqual(data, src.Data)
+		src.Data = data
+		src.mtx.Unlock()
+
+		if changed {
+			update(src.Credentials())
+		}
+	}
+}
+
+// renewIn returns the duration after which the token should be renewed,
+// that is when half of its remaining TTL has passed. False is returned
+// if the token never expires.
+func (src *VaultCredentialSource) renewIn() (time.Duration, bool) {
+	src.authMtx.Lock()
+	defer src.authMtx.Unlock()
+
+	if src.expiresAt.IsZero() {
+		return 0, false
+	}
+
+	d := time.Until(src.expiresAt) / 2
+	if d < 5*time.Second {
+		d = 5 * time.Second
+	}
+
+	return d, true
+}
+
+func (src *VaultCredentialSource) renew(ctx context.Context) error {
+	src.authMtx.Lock()
+	renewable := src.renewable
+	src.authMtx.Unlock()
+
+	if renewable {
+		var resp vaultResponse
+		err := src.do(ctx, http.MethodPost, "auth/token/renew-self", struct{}{}, &resp)
+		if err == nil && resp.Auth != nil {
+			src.setToken(resp.Auth)
+			return nil
+		}
+
+		if src.cfg.Auth == VaultAuthToken {
+			return err
+		}
+	}
+
+	if src.cfg.Auth == VaultAuthToken {
+		return errors.New("token is not renewable")
+	}
+
+	return src.login(ctx)
+}
+
+func (src *VaultCredentialSource) login(ctx context.Context) error {
+	var body any
+	switch src.cfg.Auth {
+	case VaultAuthToken:
+		src.authMtx.Lock()
+		src.token = src.cfg.Token
+		src.authMtx.Unlock()
+
+		var resp vaultResponse
+		if err := src.do(ctx, http.MethodGet, "auth/token/lookup-self", nil, &resp); err != nil {
+			return err
+		}
+
+		var data vaultTokenData
+		if err := json.Unmarshal(resp.Data, &data); err != nil {
+			return fmt.Errorf("vault: %w", err)
+		}
+
+		src.setToken(&vaultAuth{ClientToken: src.cfg.Token, LeaseDuration: data.TTL, Renewable: data.Renewable})
+
+		return nil
+	case VaultAuthAppRole:
+		secretID, err := readVaultSecret(src.cfg.SecretID, src.cfg.SecretIDFile)
+		if err != nil {
+			return err
+		}
+		body = map[string]string{"role_id": src.cfg.RoleID, "secret_id": secretID}
+	case VaultAuthKubernetes:
+		jwt, err := readVaultSecret(src.cfg.JWT, src.cfg.JWTFile)
+		if err != nil {
+			return err
+		}
+		body = map[string]string{"role": src.cfg.Role, "jwt": jwt}
+	default:
+		return fmt.Errorf("vault: unknown auth method: %v", src.cfg.Auth)
+	}
+
+	// Don't send a possibly expired token along with the login.
+	src.authMtx.Lock()
+	src.token = ""
+	src.authMtx.Unlock()
+
+	var resp vaultResponse
+	if err := src.do(ctx, http.MethodPost, path.Join("auth", src.cfg.AuthMount, "login"), body, &resp); err != nil {
+		return err
+	}
+
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return errors.New("vault: login returned no token")
+	}
+	src.setToken(resp.Auth)
+
+	return nil
+}
+
+// readVaultSecret returns the contents of file, or value if file is not set.
+func readVaultSecret(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (src *VaultCredentialSource) setToken(a *vaultAuth) {
+	src.authMtx.Lock()
+	defer src.authMtx.Unlock()
+
+	src.token = a.ClientToken
+	src.renewable = a.Renewable
+	src.expiresAt = time.Time{}
+	if a.LeaseDuration > 0 {
+		src.expiresAt = time.Now().Add(time.Duration(a.LeaseDuration) * time.Second)
+	}
+}
+
+func (src *VaultCredentialSource) read(ctx context.Context) (map[string]*Credential, error) {
+	p := strings.Trim(src.cfg.Path, "/")
+
+	if !strings.HasSuffix(src.cfg.Path, "/") {
+		c, err := src.readCredential(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]*Credential{c.AppName: c}, nil
+	}
+
+	var resp vaultResponse
+	if err := src.do(ctx, "LIST", path.Join(src.cfg.Mount, "metadata", p), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	var list vaultListData
+	if err := json.Unmarshal(resp.Data, &list); err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+
+	data := make(map[string]*Credential, len(list.Keys))
+	for _, key := range list.Keys {
+		// Skip nested folders.
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		c, err := src.readCredential(ctx, path.Join(p, key))
+		var malformed *malformedSecretError
+		var verr *vaultError
+		switch {
+		case errors.As(err, &malformed):
+			src.log.Errorw("skipping malformed credential secret", "path", path.Join(p, key), "error", err)
+			continue
+		case errors.As(err, &verr) && verr.StatusCode == http.StatusNotFound:
+			// The secret has been deleted since it was listed.
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		data[c.AppName] = c
+	}
+
+	return data, nil
+}
+
+func (src *VaultCredentialSource) readCredential(ctx context.Context, p string) (*Credential, error) {
+	name := path.Base(p)
+
+	var resp vaultResponse
+	if err := src.do(ctx, http.MethodGet, path.Join(src.cfg.Mount, "data", p), nil, &resp); err != nil {
+		return nil, fmt.Errorf("credential %v: %w", name, err)
+	}
+
+	var kv vaultKVData
+	// Keep numbers, e.g. installation IDs, as they are
+	// instead of formatting them as floats later on.
+	dec := json.NewDecoder(bytes.NewReader(resp.Data))
+	dec.UseNumber()
+	if err := dec.Decode(&kv); err != nil {
+		return nil, &malformedSecretError{fmt.Errorf("credential %v: vault: %w", name, err)}
+	}
+
+	c, err := credentialFromFields(name, func(key string) string {
+		if v, ok := kv.Data[key]; ok && v != nil {
+			return strings.TrimSpace(fmt.Sprint(v))
+		}
+
+		return ""
+	})
+	if err != nil {
+		return nil, &malformedSecretError{fmt.Errorf("credential %v: %w", name, err)}
+	}
+
+	if err := c.Validate(nil); err != nil {
+		return nil, &malformedSecretError{err}
+	}
+
+	return c, nil
+}
+
+func (src *VaultCredentialSource) do(ctx context.Context, method, p string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(src.cfg.Address, "/")+"/v1/"+p, r)
+	if err != nil {
+		return err
+	}
+
+	src.authMtx.Lock()
+	token := src.token
+	src.authMtx.Unlock()
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := src.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		verr := &vaultError{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(verr)
+
+		return verr
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
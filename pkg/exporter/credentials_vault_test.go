@@ -0,0 +1,369 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// vaultMock is a stand-in of the Vault HTTP API with
+// KV v2 secrets engine mounted at secret/.
+type vaultMock struct {
+	mtx       sync.Mutex
+	secrets   map[string]map[string]any
+	token     string
+	renewable bool
+	logins    int
+	renewals  int
+	// statuses are replied to the reads of the secrets at the paths.
+	statuses map[string]int
+}
+
+func newVaultMock() *vaultMock {
+	return &vaultMock{
+		secrets: map[string]map[string]any{
+			"github/my-app-one": {"type": "gh-app", "appId": 1, "installationId": "2", "key": testBase64Key},
+			"github/my-app-two": {"type": "gh-pat", "token": "token"},
+		},
+		renewable: true,
+	}
+}
+
+func (v *vaultMock) setSecret(path string, data map[string]any) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.secrets[path] = data
+}
+
+func (v *vaultMock) fail(path string, status int) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	if v.statuses == nil {
+		v.statuses = make(map[string]int)
+	}
+	v.statuses[path] = status
+}
+
+func (v *vaultMock) counts() (int, int) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	return v.logins, v.renewals
+}
+
+func (v *vaultMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	reply := func(body any) { json.NewEncoder(w).Encode(body) }
+	auth := func() map[string]any {
+		v.token = "s.issued"
+		return map[string]any{"client_token": v.token, "lease_duration": 3600, "renewable": v.renewable}
+	}
+	var body map[string]string
+	json.NewDecoder(r.Body).Decode(&body)
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/approle/login":
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			reply(map[string]any{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		v.logins++
+		reply(map[string]any{"auth": auth()})
+		return
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/k8s/login":
+		if body["role"] != "exporter" || body["jwt"] != "jwt" {
+			w.WriteHeader(http.StatusForbidden)
+			reply(map[string]any{"errors": []string{"permission denied"}})
+			return
+		}
+		v.logins++
+		reply(map[string]any{"auth": auth()})
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	if token == "" || token != v.token && token != "s.root" {
+		w.WriteHeader(http.StatusForbidden)
+		reply(map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/auth/token/lookup-self":
+		reply(map[string]any{"data": map[string]any{"ttl": 0, "renewable": false}})
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/token/renew-self":
+		v.renewals++
+		reply(map[string]any{"auth": auth()})
+	case r.Method == "LIST" && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+		prefix := strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/") + "/"
+		var keys []string
+		for p := range v.secrets {
+			if strings.HasPrefix(p, prefix) {
+				keys = append(keys, strings.TrimPrefix(p, prefix))
+			}
+		}
+		reply(map[string]any{"data": map[string]any{"keys": append(keys, "nested/")}})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		p := strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")
+		if status, ok := v.statuses[p]; ok {
+			w.WriteHeader(status)
+			reply(map[string]any{"errors": []string{http.StatusText(status)}})
+			return
+		}
+		data, ok := v.secrets[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			reply(map[string]any{"errors": []string{}})
+			return
+		}
+		reply(map[string]any{"data": map[string]any{"data": data}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		reply(map[string]any{"errors": []string{}})
+	}
+}
+
+func TestVaultCredentialSource(t *testing.T) {
+	t.Parallel()
+
+	newSource := func(t *testing.T, cfg VaultConfig) (*VaultCredentialSource, *vaultMock) {
+		v := newVaultMock()
+		srv := httptest.NewServer(v)
+		t.Cleanup(srv.Close)
+
+		cfg.Address = srv.URL
+		src, err := NewVaultCredentialSource(cfg, &logger.NopLogger{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return src, v
+	}
+
+	t.Run("reads credentials under prefix with approle auth", func(t *testing.T) {
+		var src CredentialSource
+		src, _ = newSource(t, VaultConfig{Path: "github/", Auth: VaultAuthAppRole, RoleID: "role", SecretID: "secret"})
+
+		assert.Len(t, src.Credentials(), 2)
+
+		data := src.(*VaultCredentialSource).Data
+		assert.Equal(t, GitHubApp, data["my-app-one"].Type)
+		assert.Equal(t, int64(1), data["my-app-one"].ID())
+		assert.Equal(t, int64(2), data["my-app-one"].InstallationID())
+		assert.Equal(t, "token", data["my-app-two"].Token())
+	})
+
+	t.Run("reads numeric installation ID", func(t *testing.T) {
+		src, v := newSource(t, VaultConfig{Path: "github/", Auth: VaultAuthToken, Token: "s.root"})
+		v.setSecret("github/my-app-one", map[string]any{"type": "gh-app", "appId": 123456, "installationId": 12345678, "key": testBase64Key})
+
+		data, err := src.read(context.Background())
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(123456), data["my-app-one"].ID())
+			assert.Equal(t, int64(12345678), data["my-app-one"].InstallationID())
+		}
+	})
+
+	t.Run("reads single credential with kubernetes auth", func(t *testing.T) {
+		src, _ := newSource(t, VaultConfig{
+			Path:      "github/my-app-two",
+			Auth:      VaultAuthKubernetes,
+			AuthMount: "k8s",
+			Role:      "exporter",
+			JWT:       "jwt",
+		})
+
+		if assert.Len(t, src.Data, 1) {
+			assert.Equal(t, "token", src.Data["my-app-two"].Token())
+		}
+	})
+
+	t.Run("re-reads service account token file on login", func(t *testing.T) {
+		jwt := filepath.Join(t.TempDir(), "token")
+		os.WriteFile(jwt, []byte("jwt\n"), 0600)
+
+		src, v := newSource(t, VaultConfig{
+			Path:      "github/",
+			Auth:      VaultAuthKubernetes,
+			AuthMount: "k8s",
+			Role:      "exporter",
+			JWTFile:   jwt,
+		})
+
+		os.WriteFile(jwt, []byte("rotated\n"), 0600)
+		assert.EqualError(t, src.login(context.Background()), "vault: 403 permission denied")
+
+		os.WriteFile(jwt, []byte("jwt\n"), 0600)
+		assert.NoError(t, src.login(context.Background()))
+
+		logins, _ := v.counts()
+		assert.Equal(t, 2, logins)
+	})
+
+	t.Run("reads credentials with token auth", func(t *testing.T) {
+		src, _ := newSource(t, VaultConfig{Path: "github/", Auth: VaultAuthToken, Token: "s.root"})
+
+		assert.Len(t, src.Data, 2)
+	})
+
+	t.Run("does not renew token without TTL", func(t *testing.T) {
+		src, _ := newSource(t, VaultConfig{Path: "github/", Auth: VaultAuthToken, Token: "s.root"})
+
+		_, ok := src.renewIn()
+		assert.False(t, ok)
+	})
+
+	t.Run("renews token at half of its TTL", func(t *testing.T) {
+		src, _ := newSource(t, VaultConfig{Path: "github/", Auth: VaultAuthAppRole, RoleID: "role", SecretID: "secret"})
+
+		d, ok := src.renewIn()
+		assert.True(t, ok)
+		assert.InDelta(t, 30*time.Minute, d, float64(time.Second))
+	})
+
+	t.Run("returns error if login fails", func(t *testing.T) {
+		srv := httptest.NewServer(newVaultMock())
+		defer srv.Close()
+
+		src, err := NewVaultCredentialSource(
+			VaultConfig{Address: srv.URL, Path: "github/", Auth: VaultAuthAppRole, RoleID: "role", SecretID: "wrong"},
+			&logger.NopLogger{},
+		)
+
+		assert.Nil(t, src)
+		assert.EqualError(t, err, "vault: 400 invalid role or secret ID")
+	})
+
+	t.Run("skips malformed secrets under prefix", func(t *testing.T) {
+		v := newVaultMock()
+		v.setSecret("github/my-app-three", map[string]any{"type": "gh-app", "appId": "three"})
+		srv := httptest.NewServer(v)
+		defer srv.Close()
+
+		src, err := NewVaultCredentialSource(
+			VaultConfig{Address: srv.URL, Path: "github/", Auth: VaultAuthToken, Token: "s.root"},
+			&logger.NopLogger{},
+		)
+
+		if assert.NoError(t, err) {
+			assert.Len(t, src.Data, 2)
+			assert.NotContains(t, src.Data, "my-app-three")
+		}
+	})
+
+	t.Run("returns error if a secret under prefix cannot be read", func(t *testing.T) {
+		src, v := newSource(t, VaultConfig{Path: "github/", Auth: VaultAuthToken, Token: "s.root"})
+		v.fail("github/my-app-two", http.StatusInternalServerError)
+
+		_, err := src.read(context.Background())
+
+		assert.EqualError(t, err, "credential my-app-two: vault: 500 Internal Server Error")
+		assert.Len(t, src.Credentials(), 2)
+	})
+
+	t.Run("skips secrets deleted since listing", func(t *testing.T) {
+		src, v := newSource(t, VaultConfig{Path: "github/", Auth: VaultAuthToken, Token: "s.root"})
+		v.fail("github/my-app-two", http.StatusNotFound)
+
+		data, err := src.read(context.Background())
+
+		if assert.NoError(t, err) {
+			assert.Len(t, data, 1)
+			assert.Contains(t, data, "my-app-one")
+		}
+	})
+
+	t.Run("returns error with malformed single secret", func(t *testing.T) {
+		v := newVaultMock()
+		v.setSecret("github/my-app-three", map[string]any{"type": "gh-app", "appId": "three"})
+		srv := httptest.NewServer(v)
+		defer srv.Close()
+
+		_, err := NewVaultCredentialSource(
+			VaultConfig{Address: srv.URL, Path: "github/my-app-three", Auth: VaultAuthToken, Token: "s.root"},
+			&logger.NopLogger{},
+		)
+
+		assert.ErrorContains(t, err, "credential my-app-three: invalid appId")
+	})
+
+	t.Run("renews renewable token", func(t *testing.T) {
+		src, v := newSource(t, VaultConfig{Path: "github/", Auth: VaultAuthAppRole, RoleID: "role", SecretID: "secret"})
+
+		assert.NoError(t, src.renew(context.Background()))
+
+		logins, renewals := v.counts()
+		assert.Equal(t, 1, logins)
+		assert.Equal(t, 1, renewals)
+	})
+
+	t.Run("logs in again if token is not renewable", func(t *testing.T) {
+		v := newVaultMock()
+		v.renewable = false
+		srv := httptest.NewServer(v)
+		defer srv.Close()
+
+		src, err := NewVaultCredentialSource(
+			VaultConfig{Address: srv.URL, Path: "github/", Auth: VaultAuthAppRole, RoleID: "role", SecretID: "secret"},
+			&logger.NopLogger{},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assert.NoError(t, src.renew(context.Background()))
+
+		logins, renewals := v.counts()
+		assert.Equal(t, 2, logins)
+		assert.Equal(t, 0, renewals)
+	})
+
+	t.Run("watch propagates rotated secrets", func(t *testing.T) {
+		src, v := newSource(t, VaultConfig{
+			Path:            "github/",
+			Auth:            VaultAuthAppRole,
+			RoleID:          "role",
+			SecretID:        "secret",
+			RefreshInterval: 10 * time.Millisecond,
+		})
+
+		updates := make(chan []*Credential, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			src.Watch(ctx, func(c []*Credential) { updates <- c })
+		}()
+
+		v.setSecret("github/my-app-two", map[string]any{"type": "gh-pat", "token": "rotated"})
+
+		select {
+		case credentials := <-updates:
+			for _, c := range credentials {
+				if c.Name() == "my-app-two" {
+					assert.Equal(t, "rotated", c.Token())
+				}
+			}
+		case <-time.After(time.Second):
+			t.Error("credentials were not updated")
+		}
+
+		cancel()
+		<-done
+	})
+}
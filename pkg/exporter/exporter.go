@@ -12,23 +12,39 @@ import (
 
 func Module() fx.Option {
 	i := Interval(30 * time.Second)
+	ns := Namespace(DefaultNamespace)
+	stale := StaleIntervals(0)
+	timeout := CollectionTimeout(DefaultCollectionTimeout)
+	concurrency := Concurrency(DefaultConcurrency)
+	retries := MaxRetries(DefaultMaxRetries)
+	installation := InstallationInterval(DefaultInstallationInterval)
+	path := CredentialsPath(FileCredentialFileName)
+	reload := CredentialsReloadInterval(time.Minute)
 	fs := afero.Afero{Fs: afero.NewOsFs()}
 
 	return fx.Options(
-		fx.Supply(&i, &fs),
+		fx.Supply(&i, &ns, &stale, &timeout, &concurrency, &retries, &installation, &path, &reload, &fs),
 		fx.Provide(
-			func(s CredentialSource) []*Credential { return s.Credentials() },
+			validCredentials,
 			func(i metrics.HTTPClientInstrumenter) Instrumenter { return i },
 			func() HttpClientWithAppFactory { return github.NewHTTPClientForApp },
 			func() HttpClientWithPATFactory { return github.NewHTTPClientForPAT },
+			func() HttpClientWithAppJWTFactory { return github.NewHTTPClientForAppJWT },
+			NewLimiter,
 			NewCollector,
 			NewMetricsHandler,
+			NewProbeHandler,
 			NewRateLimitsServiceFactory,
 			fx.Annotate(NewFileCredentialSource, fx.As(new(CredentialSource))),
 		),
 		fx.Invoke(
 			func(collector *Collector, lc fx.Lifecycle) {
 				lc.Append(fx.Hook{
+					OnStart: func(context.Context) error {
+						collector.Start()
+
+						return nil
+					},
 					OnStop: func(context.Context) error {
 						collector.Shutdown()
 
@@ -36,6 +52,48 @@ func Module() fx.Option {
 					},
 				})
 			},
+			watchCredentials,
 		),
 	)
 }
+
+// watchCredentials keeps the credentials of the collector up to date
+// if the credential source supports watching for changes.
+func watchCredentials(src CredentialSource, collector *Collector, lc fx.Lifecycle) {
+	w, ok := src.(CredentialWatcher)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				w.Watch(ctx, collector.SetCredentials)
+			}()
+
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			<-done
+
+			return nil
+		},
+	})
+}
+
+// validCredentials returns the validated credentials of the credential source.
+func validCredentials(s CredentialSource, fs *afero.Afero) ([]*Credential, error) {
+	credentials := s.Credentials()
+	for _, c := range credentials {
+		if err := c.Validate(fs); err != nil {
+			return nil, err
+		}
+	}
+
+	return credentials, nil
+}
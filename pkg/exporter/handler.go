@@ -1,25 +1,130 @@
 package exporter
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/github"
+)
+
+const (
+	// ScrapeTimeoutHeader is the header Prometheus sends the scrape timeout in.
+	ScrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+	// DefaultScrapeTimeout is used if the request doesn't set the scrape timeout.
+	DefaultScrapeTimeout = 10 * time.Second
+	// scrapeTimeoutOffset leaves time to write the response before Prometheus gives up.
+	scrapeTimeoutOffset = 500 * time.Millisecond
 )
 
 type MetricsHandler struct {
-	registry *prometheus.Registry
+	registry  *prometheus.Registry
+	collector *Collector
 }
 
 func NewMetricsHandler(c *Collector, r *prometheus.Registry) *MetricsHandler {
 	r.MustRegister(c)
 
-	return &MetricsHandler{r}
+	return &MetricsHandler{registry: r, collector: c}
 }
 
+// ServeHTTP serves the rate limits of the last polling round. Scrapes right
+// after start wait for the first round to complete, at most until shortly
+// before the scrape times out.
 func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := ScrapeContext(req)
+	defer cancel()
+
+	// Serve whatever there is if the first round takes too long.
+	h.collector.Wait(ctx)
+
 	promhttp.HandlerFor(
 		h.registry,
 		promhttp.HandlerOpts{EnableOpenMetrics: true},
+	).ServeHTTP(w, req.WithContext(ctx))
+}
+
+// ProbeModuleDefault is the probe module which
+// returns the rate limits of all resources.
+const ProbeModuleDefault = "default"
+
+// ProbeHandler collects the rate limits of a single credential on every
+// request, like the probes of the Prometheus blackbox exporter. The
+// credential is selected with the target query parameter and the module
+// query parameter is either default or the name of a single resource.
+type ProbeHandler struct {
+	collector *Collector
+}
+
+func NewProbeHandler(c *Collector) *ProbeHandler {
+	return &ProbeHandler{collector: c}
+}
+
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	target := req.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	module := req.URL.Query().Get("module")
+	resource, ok := probeResource(module)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown module %q", module), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := ScrapeContext(req)
+	defer cancel()
+
+	probe := h.collector.probe(ctx, target, resource)
+	if probe == nil {
+		http.Error(w, fmt.Sprintf("unknown target %q", target), http.StatusNotFound)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probe)
+
+	promhttp.HandlerFor(
+		registry,
+		promhttp.HandlerOpts{EnableOpenMetrics: true},
 	).ServeHTTP(w, req)
 }
+
+// probeResource returns the resource the module selects,
+// empty string for all resources.
+func probeResource(module string) (string, bool) {
+	if module == "" || module == ProbeModuleDefault {
+		return "", true
+	}
+
+	for _, r := range github.Resources {
+		if r == module {
+			return r, true
+		}
+	}
+
+	return "", false
+}
+
+// ScrapeContext returns the context of the request with a deadline shortly
+// before the scrape times out according to the scrape timeout header.
+func ScrapeContext(req *http.Request) (context.Context, context.CancelFunc) {
+	timeout := DefaultScrapeTimeout
+	if v := req.Header.Get(ScrapeTimeoutHeader); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+			timeout = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	if timeout > 2*scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	}
+
+	return context.WithTimeout(req.Context(), timeout)
+}
@@ -1,10 +1,13 @@
 package exporter
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
@@ -23,3 +26,110 @@ func TestMetricsHandlerServeHTTP(t *testing.T) {
 		assert.Equal(t, 200, rr.Result().StatusCode)
 	})
 }
+
+func TestScrapeContext(t *testing.T) {
+	t.Run("times out shortly before the scrape", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set(ScrapeTimeoutHeader, "5")
+
+		ctx, cancel := ScrapeContext(req)
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(4500*time.Millisecond), deadline, 100*time.Millisecond)
+	})
+
+	t.Run("defaults to the default scrape timeout", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set(ScrapeTimeoutHeader, "invalid")
+
+		ctx, cancel := ScrapeContext(req)
+		defer cancel()
+
+		deadline, _ := ctx.Deadline()
+		assert.WithinDuration(t, time.Now().Add(DefaultScrapeTimeout-scrapeTimeoutOffset), deadline, 100*time.Millisecond)
+	})
+
+	t.Run("is done when the request is cancelled", func(t *testing.T) {
+		reqCtx, cancelReq := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil).WithContext(reqCtx)
+
+		ctx, cancel := ScrapeContext(req)
+		defer cancel()
+		cancelReq()
+
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+}
+
+func TestMetricsHandlerWaitsForFirstRound(t *testing.T) {
+	cp := newTestCollectorParams()
+	cp.Factory.(*rateLimitsServiceFactoryMock).service.delay = time.Minute
+	c := NewCollector(cp)
+	c.Start()
+	defer c.Shutdown()
+	h := NewMetricsHandler(c, prometheus.NewRegistry())
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set(ScrapeTimeoutHeader, "0.1")
+	start := time.Now()
+	h.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestProbeHandler(t *testing.T) {
+	t.Parallel()
+
+	probe := func(h http.Handler, query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/probe?"+query, nil))
+
+		return rr
+	}
+
+	t.Run("collects rate limits of the target", func(t *testing.T) {
+		c := NewCollector(newTestCollectorParams())
+		h := NewProbeHandler(c)
+
+		rr := probe(h, "target=test-app")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		body := rr.Body.String()
+		assert.Contains(t, body, `gh_rate_limit_exporter_rate_limit_remaining{api_host="",app_id="",app_installation_id="",name="test-app",resource="test-resource",type="gh-pat"} 500`)
+		assert.Contains(t, body, `gh_rate_limit_exporter_collection_success{name="test-app",type="gh-pat"} 1`)
+		assert.Empty(t, c.limits, "probe must not touch the polled rate limits")
+	})
+
+	t.Run("keeps only the resource of the module", func(t *testing.T) {
+		h := NewProbeHandler(NewCollector(newTestCollectorParams()))
+
+		rr := probe(h, "target=test-app&module=core")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "gh_rate_limit_exporter_rate_limit_remaining{")
+		assert.Contains(t, rr.Body.String(), "gh_rate_limit_exporter_collection_success{")
+	})
+
+	t.Run("reports failed collection", func(t *testing.T) {
+		cp := newTestCollectorParams()
+		cp.Factory.(*rateLimitsServiceFactoryMock).service.err = errors.New("boom")
+		h := NewProbeHandler(NewCollector(cp))
+
+		rr := probe(h, "target=test-app")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `gh_rate_limit_exporter_collection_success{name="test-app",type="gh-pat"} 0`)
+	})
+
+	t.Run("rejects bad requests", func(t *testing.T) {
+		h := NewProbeHandler(NewCollector(newTestCollectorParams()))
+
+		assert.Equal(t, http.StatusBadRequest, probe(h, "").Code)
+		assert.Equal(t, http.StatusBadRequest, probe(h, "target=test-app&module=unknown").Code)
+		assert.Equal(t, http.StatusNotFound, probe(h, "target=unknown").Code)
+	})
+}
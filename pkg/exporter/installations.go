@@ -0,0 +1,245 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
+	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/github"
+)
+
+// installationsService collects the rate limits of all installations of a
+// GitHub App. The installations are listed every installation interval, so
+// new installations are picked up and removed ones dropped automatically.
+type installationsService struct {
+	credential *Credential
+	appClient  *http.Client
+	factory    *rateLimitsServiceFactory
+	interval   time.Duration
+	limiter    *Limiter
+	retry      github.RetryPolicy
+	log        logger.Logger
+
+	mtx           sync.Mutex
+	services      map[int64]RateLimitsService
+	installations []*github.Installation
+	listedAt      time.Time
+}
+
+func (f *rateLimitsServiceFactory) newInstallationsService(c *Credential) (*installationsService, error) {
+	if f.createHTTPClientWithAppJWT == nil {
+		return nil, errors.New("discovering installations requires authenticating as the app")
+	}
+
+	appClient, err := f.createHTTPClientWithAppJWT(c)
+	if err != nil {
+		return nil, err
+	}
+
+	f.instrumenter.Instrument(appClient)
+
+	return &installationsService{
+		credential: c.clone(),
+		appClient:  appClient,
+		factory:    f,
+		interval:   f.installationInterval,
+		limiter:    f.limiter,
+		retry:      f.retry,
+		log:        f.log,
+		services:   make(map[int64]RateLimitsService),
+	}, nil
+}
+
+// RateLimits returns the rate limits of all installations, which are told
+// apart by their installation ID. The installations are collected in the
+// slot of the limiter the caller holds and in as many further slots as are
+// free, and retried one by one. Installations which fail are logged and
+// left out, so the collection only fails if listing the installations or
+// every installation fails.
+func (s *installationsService) RateLimits(ctx context.Context) ([]*github.RateLimit, error) {
+	installations, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := make([][]*github.RateLimit, len(installations))
+	errs := make([]error, len(installations))
+
+	queue := make(chan int, len(installations))
+	for i := range installations {
+		queue <- i
+	}
+	close(queue)
+
+	work := func() {
+		for i := range queue {
+			limits[i], errs[i] = s.collect(ctx, installations[i].ID)
+		}
+	}
+
+	// Further slots are only waited for until the queue is
+	// drained, so holding a slot while waiting can't deadlock.
+	done := make(chan struct{})
+	helpers := len(installations) - 1
+	if slots := s.limiter.size() - 1; helpers > slots {
+		helpers = slots
+	}
+
+	var wg sync.WaitGroup
+	for n := 0; n < helpers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if !s.limiter.acquire(ctx, done) {
+				return
+			}
+			defer s.limiter.release()
+
+			work()
+		}()
+	}
+	work()
+	close(done)
+	wg.Wait()
+
+	var res []*github.RateLimit
+	var failed int
+	var first error
+	for i, installation := range installations {
+		if errs[i] != nil {
+			if first == nil {
+				first = fmt.Errorf("installation %v: %w", installation.ID, errs[i])
+			}
+			failed++
+			continue
+		}
+		res = append(res, limits[i]...)
+	}
+
+	if failed > 0 && failed == len(installations) {
+		return nil, fmt.Errorf("all %v installations failed: %w", failed, first)
+	}
+
+	return res, nil
+}
+
+// collect collects the rate limits of a single installation. The service of
+// the installation is dropped if its credentials are rejected, so it starts
+// with a fresh installation token next time.
+func (s *installationsService) collect(ctx context.Context, id int64) ([]*github.RateLimit, error) {
+	c := s.credential.clone()
+	c.AppCredential.InstallationID = id
+
+	rls, err := s.service(ctx, c)
+	if err != nil {
+		s.log.Warnw("creating GitHub client of installation failed", logFields(c, err)...)
+		return nil, err
+	}
+
+	var limits []*github.RateLimit
+	err = s.retry.Do(ctx, func(ctx context.Context) error {
+		limits, err = rls.RateLimits(ctx)
+		return err
+	}, func(err error, wait time.Duration) {
+		s.log.Warnw("retrying collection of installation", append(logFields(c, err), "backoff", wait.Round(time.Millisecond))...)
+	})
+	if err != nil {
+		if github.IsAuthError(err) {
+			s.mtx.Lock()
+			delete(s.services, id)
+			s.mtx.Unlock()
+		}
+		s.log.Warnw("collection of installation failed", logFields(c, err)...)
+		return nil, err
+	}
+
+	return limits, nil
+}
+
+// service returns the service of the installation of c,
+// which is created unless it exists already.
+func (s *installationsService) service(ctx context.Context, c *Credential) (RateLimitsService, error) {
+	id := c.InstallationID()
+
+	s.mtx.Lock()
+	rls, ok := s.services[id]
+	s.mtx.Unlock()
+
+	if ok {
+		return rls, nil
+	}
+
+	rls, err := s.factory.Create(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Another collection may have created the service meanwhile.
+	if existing, ok := s.services[id]; ok {
+		return existing, nil
+	}
+	s.services[id] = rls
+
+	return rls, nil
+}
+
+// list returns the installations, which are listed again once the
+// installation interval has passed. If listing fails then the previously
+// listed installations are used until the next collection.
+func (s *installationsService) list(ctx context.Context) ([]*github.Installation, error) {
+	s.mtx.Lock()
+	installations := s.installations
+	due := installations == nil || time.Since(s.listedAt) >= s.interval
+	s.mtx.Unlock()
+
+	if !due {
+		return installations, nil
+	}
+
+	var listed []*github.Installation
+	err := s.retry.Do(ctx, func(ctx context.Context) error {
+		var err error
+		listed, err = github.ListInstallations(ctx, s.credential, s.appClient)
+		return err
+	}, nil)
+	if err != nil {
+		if installations == nil {
+			return nil, err
+		}
+
+		s.log.Warnw("listing installations failed, using previous installations", logFields(s.credential, err)...)
+		return installations, nil
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Drop the services of installations which are gone.
+	ids := make(map[int64]struct{}, len(listed))
+	for _, i := range listed {
+		ids[i.ID] = struct{}{}
+	}
+	for id := range s.services {
+		if _, ok := ids[id]; !ok {
+			delete(s.services, id)
+		}
+	}
+
+	s.installations = append([]*github.Installation{}, listed...)
+	s.listedAt = time.Now()
+
+	return s.installations, nil
+}
+
+// Installations returns the installations of the GitHub App.
+func (s *installationsService) Installations(ctx context.Context) ([]*github.Installation, error) {
+	return s.list(ctx)
+}
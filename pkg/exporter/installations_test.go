@@ -0,0 +1,359 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/logger"
+	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// installationsServer emulates the GitHub Enterprise Server API
+// of a GitHub App which is installed on the given accounts.
+type installationsServer struct {
+	mtx      sync.Mutex
+	accounts map[int64]string
+	// statuses are replied to the rate limit requests of
+	// an installation, one by one, before it succeeds.
+	statuses  map[int64][]int
+	lists     int
+	requests  int
+	active    int
+	maxActive int
+}
+
+func (s *installationsServer) install(id int64, account string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.accounts[id] = account
+}
+
+func (s *installationsServer) fail(id int64, statuses ...int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.statuses == nil {
+		s.statuses = make(map[int64][]int)
+	}
+	s.statuses[id] = statuses
+}
+
+func (s *installationsServer) counts() (int, int, int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.lists, s.requests, s.maxActive
+}
+
+func (s *installationsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/api/v3/app/installations":
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		s.lists++
+		var list []string
+		for id, account := range s.accounts {
+			list = append(list, fmt.Sprintf(`{"id":%v,"app_id":1,"account":{"login":%q,"type":"Organization"}}`, id, account))
+		}
+		w.Write([]byte("[" + strings.Join(list, ",") + "]"))
+	case strings.HasSuffix(r.URL.Path, "/access_tokens"):
+		id := strings.Split(r.URL.Path, "/")[5]
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token":"token-` + id + `"}`))
+	case r.URL.Path == "/api/v3/rate_limit":
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "token token-")
+		id, err := strconv.ParseInt(token, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		s.mtx.Lock()
+		s.requests++
+		s.active++
+		if s.active > s.maxActive {
+			s.maxActive = s.active
+		}
+		var status int
+		if statuses := s.statuses[id]; len(statuses) > 0 {
+			status, s.statuses[id] = statuses[0], statuses[1:]
+		}
+		s.mtx.Unlock()
+
+		// Let concurrent requests overlap.
+		time.Sleep(10 * time.Millisecond)
+
+		s.mtx.Lock()
+		s.active--
+		s.mtx.Unlock()
+
+		if status != 0 {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"message":"failed"}`))
+			return
+		}
+		w.Write([]byte(`{"resources":{"core":{"limit":5000,"remaining":4990,"reset":1700000000,"used":10}}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestInstallationsService(t *testing.T) {
+	t.Parallel()
+
+	newCredential := func(t *testing.T, baseURL string) *Credential {
+		c := &Credential{
+			Type:          GitHubApp,
+			AppName:       "my-app",
+			Endpoint:      Endpoint{BaseURL: baseURL},
+			AppCredential: &AppCredential{ID: 1, Key: Secret(testKey)},
+		}
+		if err := c.Validate(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	}
+
+	newFactory := func(interval time.Duration, concurrency int64) RateLimitsServiceFactory {
+		i := InstallationInterval(interval)
+		c := Concurrency(concurrency)
+
+		return NewRateLimitsServiceFactory(RateLimitsServiceFactoryParams{
+			Instrumenter:                &instrumenterMock{},
+			HttpClientWithPATFactory:    github.NewHTTPClientForPAT,
+			HttpClientWithAppFactory:    github.NewHTTPClientForApp,
+			HttpClientWithAppJWTFactory: github.NewHTTPClientForAppJWT,
+			Installation:                &i,
+			Concurrency:                 &c,
+		})
+	}
+
+	newService := func(t *testing.T, f RateLimitsServiceFactory, baseURL string) *installationsService {
+		rls, err := f.Create(context.Background(), newCredential(t, baseURL))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		s := rls.(*installationsService)
+		s.retry.MinBackoff = time.Millisecond
+		s.retry.MaxBackoff = time.Millisecond
+
+		return s
+	}
+
+	installationIDs := func(limits []*github.RateLimit) []string {
+		var ids []string
+		for _, rl := range limits {
+			ids = append(ids, rl.AppInstallationID)
+		}
+
+		return ids
+	}
+
+	t.Run("collects rate limits of all installations", func(t *testing.T) {
+		gh := &installationsServer{accounts: map[int64]string{2: "foo", 4: "bar"}}
+		srv := httptest.NewServer(gh)
+		defer srv.Close()
+
+		rls, err := newFactory(time.Hour, 10).Create(context.Background(), newCredential(t, srv.URL))
+		if !assert.NoError(t, err) {
+			return
+		}
+		limits, err := rls.RateLimits(context.Background())
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"2", "4"}, installationIDs(limits))
+	})
+
+	t.Run("lists installations every installation interval", func(t *testing.T) {
+		gh := &installationsServer{accounts: map[int64]string{2: "foo"}}
+		srv := httptest.NewServer(gh)
+		defer srv.Close()
+
+		s := newService(t, newFactory(time.Hour, 10), srv.URL)
+		s.RateLimits(context.Background())
+		gh.install(6, "baz")
+		limits, err := s.RateLimits(context.Background())
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"2"}, installationIDs(limits))
+
+		s.mtx.Lock()
+		s.listedAt = time.Now().Add(-time.Hour)
+		s.mtx.Unlock()
+		limits, err = s.RateLimits(context.Background())
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"2", "6"}, installationIDs(limits))
+
+		installations, err := s.Installations(context.Background())
+		if assert.NoError(t, err) {
+			assert.Len(t, installations, 2)
+		}
+
+		lists, _, _ := gh.counts()
+		assert.Equal(t, 2, lists)
+	})
+
+	t.Run("leaves out failing installations", func(t *testing.T) {
+		gh := &installationsServer{accounts: map[int64]string{2: "foo", 4: "bar"}}
+		gh.fail(4, http.StatusUnauthorized)
+		srv := httptest.NewServer(gh)
+		defer srv.Close()
+
+		s := newService(t, newFactory(time.Hour, 10), srv.URL)
+		limits, err := s.RateLimits(context.Background())
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"2"}, installationIDs(limits))
+
+		// Only the service of the rejected installation is dropped.
+		s.mtx.Lock()
+		assert.Contains(t, s.services, int64(2))
+		assert.NotContains(t, s.services, int64(4))
+		s.mtx.Unlock()
+
+		limits, err = s.RateLimits(context.Background())
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"2", "4"}, installationIDs(limits))
+	})
+
+	t.Run("fails if every installation fails", func(t *testing.T) {
+		gh := &installationsServer{accounts: map[int64]string{2: "foo"}}
+		gh.fail(2, http.StatusUnauthorized)
+		srv := httptest.NewServer(gh)
+		defer srv.Close()
+
+		_, err := newService(t, newFactory(time.Hour, 10), srv.URL).RateLimits(context.Background())
+
+		assert.ErrorContains(t, err, "all 1 installations failed: installation 2:")
+		assert.True(t, github.IsAuthError(err))
+	})
+
+	t.Run("retries installations one by one", func(t *testing.T) {
+		gh := &installationsServer{accounts: map[int64]string{2: "foo", 4: "bar"}}
+		gh.fail(4, http.StatusBadGateway)
+		srv := httptest.NewServer(gh)
+		defer srv.Close()
+
+		s := newService(t, newFactory(time.Hour, 10), srv.URL)
+		limits, err := s.RateLimits(context.Background())
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"2", "4"}, installationIDs(limits))
+	})
+
+	t.Run("collector does not retry installations as a whole", func(t *testing.T) {
+		gh := &installationsServer{accounts: map[int64]string{2: "foo"}}
+		gh.fail(2, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+		srv := httptest.NewServer(gh)
+		defer srv.Close()
+
+		interval := Interval(time.Second)
+		f := newFactory(time.Hour, 10)
+		f.(*rateLimitsServiceFactory).retry.MinBackoff = time.Millisecond
+		f.(*rateLimitsServiceFactory).retry.MaxBackoff = time.Millisecond
+		c := NewCollector(CollectorParams{
+			Interval:     &interval,
+			Credentials:  []*Credential{newCredential(t, srv.URL)},
+			Instrumenter: &instrumenterMock{},
+			Factory:      f,
+			Log:          &logger.NopLogger{},
+		})
+
+		col := c.collectAll(context.Background())[0]
+
+		assert.Error(t, col.err)
+		_, requests, _ := gh.counts()
+		assert.Equal(t, DefaultMaxRetries+1, requests)
+	})
+
+	t.Run("collects installations at most concurrency at a time", func(t *testing.T) {
+		gh := &installationsServer{accounts: map[int64]string{2: "foo", 4: "bar", 6: "baz", 8: "qux"}}
+		srv := httptest.NewServer(gh)
+		defer srv.Close()
+
+		s := newService(t, newFactory(time.Hour, 2), srv.URL)
+		limits, err := s.RateLimits(context.Background())
+
+		assert.NoError(t, err)
+		assert.Len(t, limits, 4)
+
+		_, _, maxActive := gh.counts()
+		assert.LessOrEqual(t, maxActive, 2)
+	})
+
+	t.Run("shares concurrency with collector", func(t *testing.T) {
+		gh := &installationsServer{accounts: map[int64]string{2: "foo", 4: "bar", 6: "baz", 8: "qux"}}
+		srv := httptest.NewServer(gh)
+		defer srv.Close()
+
+		var credentials []*Credential
+		for _, name := range []string{"one", "two", "three"} {
+			c := newCredential(t, srv.URL)
+			c.AppName = name
+			credentials = append(credentials, c)
+		}
+		concurrency := Concurrency(2)
+		limiter := NewLimiter(&concurrency)
+		f := NewRateLimitsServiceFactory(RateLimitsServiceFactoryParams{
+			Instrumenter:                &instrumenterMock{},
+			HttpClientWithPATFactory:    github.NewHTTPClientForPAT,
+			HttpClientWithAppFactory:    github.NewHTTPClientForApp,
+			HttpClientWithAppJWTFactory: github.NewHTTPClientForAppJWT,
+			Limiter:                     limiter,
+		})
+		interval := Interval(time.Second)
+		c := NewCollector(CollectorParams{
+			Interval:     &interval,
+			Credentials:  credentials,
+			Instrumenter: &instrumenterMock{},
+			Factory:      f,
+			Log:          &logger.NopLogger{},
+			Limiter:      limiter,
+		})
+
+		for _, col := range c.collectAll(context.Background()) {
+			assert.NoError(t, col.err)
+			assert.Len(t, col.limits, 4)
+		}
+
+		_, _, maxActive := gh.counts()
+		assert.LessOrEqual(t, maxActive, 2)
+	})
+
+	t.Run("authenticates as installations only once discovered", func(t *testing.T) {
+		var clients int
+		p := newRateLimitsServiceFactoryParamsMock()
+		p.HttpClientWithAppFactory = func(a github.App) (*http.Client, error) {
+			clients++
+			return http.DefaultClient, nil
+		}
+		p.HttpClientWithAppJWTFactory = github.NewHTTPClientForAppJWT
+
+		_, err := NewRateLimitsServiceFactory(p).Create(context.Background(), newCredential(t, ""))
+
+		assert.NoError(t, err)
+		assert.Zero(t, clients)
+	})
+
+	t.Run("requires authenticating as the app", func(t *testing.T) {
+		f := NewRateLimitsServiceFactory(newRateLimitsServiceFactoryParamsMock())
+
+		_, err := f.Create(context.Background(), newCredential(t, ""))
+
+		assert.EqualError(t, err, "discovering installations requires authenticating as the app")
+	})
+}
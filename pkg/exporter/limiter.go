@@ -0,0 +1,41 @@
+package exporter
+
+import "context"
+
+// Limiter limits how many collections of rate limits run concurrently.
+// The collector, its probes and the installations of GitHub Apps share a
+// single limiter, so the concurrency bounds all their requests together.
+type Limiter struct {
+	slots chan struct{}
+}
+
+func NewLimiter(c *Concurrency) *Limiter {
+	concurrency := DefaultConcurrency
+	if c != nil && *c > 0 {
+		concurrency = int(*c)
+	}
+
+	return &Limiter{slots: make(chan struct{}, concurrency)}
+}
+
+// acquire waits for a free slot, which must be released afterwards. False is
+// returned without a slot if ctx is done or done is closed in the meantime.
+func (l *Limiter) acquire(ctx context.Context, done <-chan struct{}) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-done:
+		return false
+	}
+}
+
+func (l *Limiter) release() {
+	<-l.slots
+}
+
+// size returns how many slots can be acquired at a time.
+func (l *Limiter) size() int {
+	return cap(l.slots)
+}
@@ -0,0 +1,94 @@
+package exporter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/github"
+)
+
+type (
+	// CredentialStatus is the collection status of a credential.
+	// It never contains the secrets of the credential.
+	CredentialStatus struct {
+		Name           string `json:"name"`
+		Type           string `json:"type"`
+		AppID          int64  `json:"appId,omitempty"`
+		InstallationID int64  `json:"installationId,omitempty"`
+		BaseURL        string `json:"baseURL,omitempty"`
+		// LastCollection is when the rate limits were collected last,
+		// nil if the first collection has not completed yet.
+		LastCollection *time.Time      `json:"lastCollection"`
+		LastSuccess    *time.Time      `json:"lastSuccess"`
+		LastError      string          `json:"lastError,omitempty"`
+		ErrorClass     string          `json:"errorClass,omitempty"`
+		RateLimits     []ResourceLimit `json:"rateLimits"`
+	}
+
+	// ResourceLimit is the last collected rate limit of a resource.
+	ResourceLimit struct {
+		Resource string `json:"resource"`
+		// InstallationID tells apart the rate limits of the installations
+		// of a GitHub App whose installations are discovered.
+		InstallationID string    `json:"installationId,omitempty"`
+		Limit          int       `json:"limit"`
+		Remaining      int       `json:"remaining"`
+		Used           int       `json:"used"`
+		Reset          time.Time `json:"reset"`
+	}
+)
+
+// Status returns the collection status of the credentials sorted by name.
+func (c *Collector) Status() []CredentialStatus {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	limits := make(map[string][]ResourceLimit, len(c.credentials))
+	for _, rl := range c.limits {
+		limits[rl.AppName] = append(limits[rl.AppName], ResourceLimit{
+			Resource:       rl.Resource,
+			InstallationID: rl.AppInstallationID,
+			Limit:          rl.Limit,
+			Remaining:      rl.Remaining,
+			Used:           rl.Used,
+			Reset:          rl.Reset,
+		})
+	}
+
+	status := make([]CredentialStatus, 0, len(c.credentials))
+	for _, credential := range c.credentials {
+		s := CredentialStatus{
+			Name:       credential.AppName,
+			Type:       credential.Kind(),
+			BaseURL:    credential.BaseURL(),
+			RateLimits: limits[credential.AppName],
+		}
+		if credential.AppCredential != nil {
+			s.AppID = credential.ID()
+			s.InstallationID = credential.InstallationID()
+		}
+
+		if st, ok := c.status[credential.AppName]; ok {
+			s.LastCollection = timeOrNil(st.lastCollection)
+			s.LastSuccess = timeOrNil(st.lastSuccess)
+			if st.lastError != nil {
+				s.LastError = st.lastError.Error()
+				s.ErrorClass = github.ErrorClass(st.lastError)
+			}
+		}
+
+		status = append(status, s)
+	}
+
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+
+	return status
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
@@ -2,9 +2,13 @@ package github
 
 import (
 	"context"
-	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bradleyfalzon/ghinstallation/v2"
@@ -15,6 +19,12 @@ import (
 type Metadata interface {
 	Name() string
 	Kind() string
+	// BaseURL is the API URL of a GitHub Enterprise Server
+	// or empty string for the public GitHub API.
+	BaseURL() string
+	// UploadURL is the upload URL of a GitHub Enterprise Server.
+	// Empty string defaults to BaseURL.
+	UploadURL() string
 }
 
 type App interface {
@@ -22,7 +32,7 @@ type App interface {
 
 	ID() int64
 	InstallationID() int64
-	Base64PrivateKey() string
+	PrivateKey() ([]byte, error)
 }
 
 type PAT interface {
@@ -32,26 +42,69 @@ type PAT interface {
 }
 
 type RateLimit struct {
-	Resource          string
-	Limit             int
-	Remaining         int
-	Reset             time.Time
+	Resource  string
+	Limit     int
+	Remaining int
+	Used      int
+	Reset     time.Time
+	// Time is when the rate limit was read.
+	Time              time.Time
 	AppName           string
 	AppKind           string
 	AppID             string
 	AppInstallationID string
+	APIHost           string
+	// Token describes the personal access token the rate
+	// limit was read with, nil for GitHub Apps.
+	Token *Token
 }
 
-func NewRateLimit(resource string, m *metadata, r *github.Rate) *RateLimit {
+// Kinds of personal access tokens.
+const (
+	TokenKindClassic     = "classic"
+	TokenKindFineGrained = "fine-grained"
+)
+
+const (
+	// tokenExpirationHeader is sent for expiring personal access tokens.
+	tokenExpirationHeader = "GitHub-Authentication-Token-Expiration"
+	// scopesHeader is sent for classic personal access tokens.
+	scopesHeader = "X-OAuth-Scopes"
+	// fineGrainedTokenPrefix is the prefix of fine-grained personal access tokens.
+	fineGrainedTokenPrefix = "github_pat_"
+)
+
+// Token describes a personal access token.
+type Token struct {
+	Kind string
+	// Scopes are the sorted OAuth scopes of a classic token.
+	Scopes []string
+	// Expiration is zero if the token doesn't expire.
+	Expiration time.Time
+	// Owner is the login of the user the token belongs
+	// to or empty string if it couldn't be read.
+	Owner string
+}
+
+func NewRateLimit(resource string, m *metadata, r *rate, t time.Time) *RateLimit {
+	// Older GitHub Enterprise Server versions don't report the used requests.
+	used := r.Limit - r.Remaining
+	if r.Used != nil {
+		used = *r.Used
+	}
+
 	return &RateLimit{
 		Resource:          resource,
 		Limit:             r.Limit,
 		Remaining:         r.Remaining,
+		Used:              used,
 		Reset:             r.Reset.Time,
+		Time:              t,
 		AppName:           m.name,
 		AppKind:           m.kind,
 		AppID:             m.id,
 		AppInstallationID: m.installationId,
+		APIHost:           m.apiHost,
 	}
 }
 
@@ -64,34 +117,85 @@ type metadata struct {
 	kind           string
 	id             string
 	installationId string
+	apiHost        string
 }
 
 type gitHubClient struct {
-	metadata *metadata
-	client   *github.Client
+	metadata   *metadata
+	client     *github.Client
+	httpClient *http.Client
+	// appClient authenticates as the GitHub App itself.
+	appClient *http.Client
+	// pat is set for clients which authenticate with a personal access
+	// token. Unauthenticated clients have no token to describe.
+	pat         bool
+	fineGrained bool
+	ownerMtx    sync.Mutex
+	owner       string
+	// ownerRetryInterval is how long the owner isn't read
+	// again after reading it has failed at ownerFailedAt.
+	ownerRetryInterval time.Duration
+	ownerFailedAt      time.Time
 }
 
-func NewGitHubClientForApp(app App, c *http.Client) *gitHubClient {
-	client := github.NewClient(c)
+// DefaultOwnerRetryInterval is how long the token owner
+// isn't read again after reading it has failed.
+const DefaultOwnerRetryInterval = time.Hour
+
+// NewGitHubClientForApp returns a client which authenticates as the installation
+// with c and, if appClient is not nil, as the GitHub App with appClient.
+func NewGitHubClientForApp(app App, c *http.Client, appClient *http.Client) (*gitHubClient, error) {
+	client, err := newClient(app, c)
+	if err != nil {
+		return nil, err
+	}
+
 	metadata := &metadata{
 		name:           app.Name(),
 		id:             fmt.Sprint(app.ID()),
 		installationId: fmt.Sprint(app.InstallationID()),
 		kind:           app.Kind(),
+		apiHost:        client.BaseURL.Host,
 	}
 
-	return &gitHubClient{metadata: metadata, client: client}
+	return &gitHubClient{metadata: metadata, client: client, httpClient: c, appClient: appClient}, nil
 }
 
-func NewGitHubClientForPAT(pat PAT, c *http.Client) *gitHubClient {
-	client := github.NewClient(c)
-	metadata := &metadata{name: pat.Name(), kind: pat.Kind()}
+func NewGitHubClientForPAT(pat PAT, c *http.Client) (*gitHubClient, error) {
+	client, err := newClient(pat, c)
+	if err != nil {
+		return nil, err
+	}
 
-	return &gitHubClient{metadata: metadata, client: client}
+	metadata := &metadata{name: pat.Name(), kind: pat.Kind(), apiHost: client.BaseURL.Host}
+
+	return &gitHubClient{
+		metadata:           metadata,
+		client:             client,
+		httpClient:         c,
+		pat:                pat.Token() != "",
+		fineGrained:        strings.HasPrefix(pat.Token(), fineGrainedTokenPrefix),
+		ownerRetryInterval: DefaultOwnerRetryInterval,
+	}, nil
+}
+
+// newClient returns a client for the public GitHub API or, if
+// the base URL is set, for the GitHub Enterprise Server API.
+func newClient(m Metadata, c *http.Client) (*github.Client, error) {
+	if m.BaseURL() == "" {
+		return github.NewClient(c), nil
+	}
+
+	upload := m.UploadURL()
+	if upload == "" {
+		upload = m.BaseURL()
+	}
+
+	return github.NewEnterpriseClient(m.BaseURL(), upload, c)
 }
 
 func NewHTTPClientForApp(app App) (*http.Client, error) {
-	key, err := base64.StdEncoding.DecodeString(app.Base64PrivateKey())
+	key, err := app.PrivateKey()
 	if err != nil {
 		return nil, err
 	}
@@ -106,40 +210,290 @@ func NewHTTPClientForApp(app App) (*http.Client, error) {
 		return nil, err
 	}
 
+	if app.BaseURL() != "" {
+		// Installation tokens are issued by the same
+		// GitHub Enterprise Server the App is registered on.
+		client, err := newClient(app, nil)
+		if err != nil {
+			return nil, err
+		}
+		itr.BaseURL = strings.TrimSuffix(client.BaseURL.String(), "/")
+	}
+
 	return &http.Client{Transport: itr}, nil
 }
 
+// NewHTTPClientForAppJWT returns a client which authenticates as
+// the GitHub App itself with a JSON Web Token signed by its private key.
+func NewHTTPClientForAppJWT(app App) (*http.Client, error) {
+	key, err := app.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	atr, err := ghinstallation.NewAppsTransport(http.DefaultTransport, app.ID(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{Transport: atr}, nil
+}
+
+// NewHTTPClientForPAT returns a client which authenticates with the personal
+// access token. Without a token the client doesn't authenticate at all.
 func NewHTTPClientForPAT(ctx context.Context, pat PAT) *http.Client {
+	if pat.Token() == "" {
+		return &http.Client{}
+	}
+
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: pat.Token()})
 	return oauth2.NewClient(ctx, ts)
 }
 
-type resourceRateLimit struct {
-	resource string
-	rate     *github.Rate
+type (
+	// rate is github.Rate with the used requests, which
+	// the go-github version in use doesn't decode.
+	rate struct {
+		Limit     int              `json:"limit"`
+		Remaining int              `json:"remaining"`
+		Used      *int             `json:"used"`
+		Reset     github.Timestamp `json:"reset"`
+	}
+
+	rateLimitsResponse struct {
+		Resources map[string]*rate `json:"resources"`
+	}
+)
+
+// Resources are the exported rate limit resources in the order of export.
+var Resources = []string{
+	"core",
+	"search",
+	"graphql",
+	"scim",
+	"source_import",
+	"code_scanning_upload",
+	"integration_manifest",
+	"actions_runner_registration",
 }
 
 func (c *gitHubClient) RateLimits(ctx context.Context) ([]*RateLimit, error) {
-	limits, _, err := c.client.RateLimits(ctx)
+	req, err := c.client.NewRequest(http.MethodGet, "rate_limit", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send the request with the underlying HTTP client because go-github
+	// refuses to send requests once the core rate limit is exhausted, and
+	// reading the rate limits doesn't count against the rate limit anyway.
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
+	if err := github.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var limits rateLimitsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&limits); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	var token *Token
+	if c.pat {
+		token = c.token(ctx, resp.Header)
+	}
 
 	var rateLimits []*RateLimit
-	for _, r := range []*resourceRateLimit{
-		{resource: "core", rate: limits.Core},
-		{resource: "search", rate: limits.Search},
-		{resource: "graphql", rate: limits.GraphQL},
-		{resource: "scim", rate: limits.SCIM},
-		{resource: "source_import", rate: limits.SourceImport},
-		{resource: "code_scanning_upload", rate: limits.CodeScanningUpload},
-		{resource: "integration_manifest", rate: limits.IntegrationManifest},
-		{resource: "actions_runner_registration", rate: limits.ActionsRunnerRegistration},
-	} {
-		if r.rate != nil {
-			rateLimits = append(rateLimits, NewRateLimit(r.resource, c.metadata, r.rate))
+	for _, resource := range Resources {
+		if r := limits.Resources[resource]; r != nil {
+			rl := NewRateLimit(resource, c.metadata, r, now)
+			rl.Token = token
+			rateLimits = append(rateLimits, rl)
 		}
 	}
 
 	return rateLimits, nil
 }
+
+// ErrNoAppClient is returned by Installations if
+// the client cannot authenticate as the GitHub App.
+var ErrNoAppClient = errors.New("github: client cannot authenticate as the app")
+
+// Installation describes the installation of a GitHub App.
+type Installation struct {
+	ID    int64
+	AppID int64
+	// Account is the login of the organization or user
+	// the GitHub App is installed on.
+	Account string
+	// AccountType is either organization or user.
+	AccountType string
+	// RepositorySelection is either all or selected.
+	RepositorySelection string
+	// Permissions maps the permissions granted to the
+	// installation to their access level, e.g. read or write.
+	Permissions map[string]string
+}
+
+type installationResponse struct {
+	ID      int64 `json:"id"`
+	AppID   int64 `json:"app_id"`
+	Account struct {
+		Login string `json:"login"`
+		Type  string `json:"type"`
+	} `json:"account"`
+	RepositorySelection string            `json:"repository_selection"`
+	Permissions         map[string]string `json:"permissions"`
+	SuspendedAt         *time.Time        `json:"suspended_at"`
+}
+
+func (i *installationResponse) installation() *Installation {
+	return &Installation{
+		ID:                  i.ID,
+		AppID:               i.AppID,
+		Account:             i.Account.Login,
+		AccountType:         strings.ToLower(i.Account.Type),
+		RepositorySelection: i.RepositorySelection,
+		Permissions:         i.Permissions,
+	}
+}
+
+// Installations reads the installation of the client, which
+// requires authenticating as the GitHub App itself.
+func (c *gitHubClient) Installations(ctx context.Context) ([]*Installation, error) {
+	if c.appClient == nil {
+		return nil, ErrNoAppClient
+	}
+
+	req, err := c.client.NewRequest(http.MethodGet, "app/installations/"+c.metadata.installationId, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.appClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := github.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var i installationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&i); err != nil {
+		return nil, err
+	}
+
+	return []*Installation{i.installation()}, nil
+}
+
+// ListInstallations lists the installations of the GitHub App, authenticating
+// as the GitHub App itself with appClient. Suspended installations are
+// skipped because they can't be authenticated as.
+func ListInstallations(ctx context.Context, app App, appClient *http.Client) ([]*Installation, error) {
+	client, err := newClient(app, appClient)
+	if err != nil {
+		return nil, err
+	}
+
+	var installations []*Installation
+	for page := 1; page != 0; {
+		req, err := client.NewRequest(http.MethodGet, fmt.Sprintf("app/installations?per_page=100&page=%v", page), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var list []*installationResponse
+		resp, err := client.Do(ctx, req, &list)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range list {
+			if i.SuspendedAt == nil {
+				installations = append(installations, i.installation())
+			}
+		}
+
+		page = resp.NextPage
+	}
+
+	return installations, nil
+}
+
+// token describes the personal access token of the client according
+// to the headers GitHub API responds with to the token's requests.
+func (c *gitHubClient) token(ctx context.Context, h http.Header) *Token {
+	token := &Token{Kind: TokenKindClassic, Owner: c.tokenOwner(ctx)}
+
+	// Fine-grained tokens have no scopes, so GitHub
+	// doesn't send the scopes header for them.
+	scopes, ok := h[http.CanonicalHeaderKey(scopesHeader)]
+	if c.fineGrained || !ok {
+		token.Kind = TokenKindFineGrained
+	} else {
+		token.Scopes = parseScopes(strings.Join(scopes, ","))
+	}
+
+	if v := h.Get(tokenExpirationHeader); v != "" {
+		token.Expiration, _ = parseTokenExpiration(v)
+	}
+
+	return token
+}
+
+// tokenOwner returns the login of the user the token belongs to.
+// The owner is read once and then reused for the lifetime of the client.
+// As reading the owner counts against the core rate limit, a failure
+// is not retried until the owner retry interval has passed.
+func (c *gitHubClient) tokenOwner(ctx context.Context) string {
+	c.ownerMtx.Lock()
+	defer c.ownerMtx.Unlock()
+
+	if c.owner != "" || time.Since(c.ownerFailedAt) < c.ownerRetryInterval {
+		return c.owner
+	}
+
+	user, _, err := c.client.Users.Get(ctx, "")
+	if err != nil {
+		c.ownerFailedAt = time.Now()
+		return ""
+	}
+	c.owner = user.GetLogin()
+
+	return c.owner
+}
+
+func parseScopes(v string) []string {
+	var scopes []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	sort.Strings(scopes)
+
+	return scopes
+}
+
+// parseTokenExpiration parses the token expiration header,
+// e.g. "2023-03-01 12:00:00 UTC" or "2023-03-01 12:00:00 +0100".
+func parseTokenExpiration(v string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02 15:04:05 -0700", v)
+	if err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02 15:04:05 MST", v)
+}
@@ -0,0 +1,345 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type credentialMock struct {
+	baseURL string
+	key     []byte
+	token   string
+}
+
+func (c *credentialMock) Name() string                { return "test" }
+func (c *credentialMock) Kind() string                { return "test" }
+func (c *credentialMock) BaseURL() string             { return c.baseURL }
+func (c *credentialMock) UploadURL() string           { return "" }
+func (c *credentialMock) ID() int64                   { return 1 }
+func (c *credentialMock) InstallationID() int64       { return 2 }
+func (c *credentialMock) PrivateKey() ([]byte, error) { return c.key, nil }
+func (c *credentialMock) Token() string {
+	if c.token == "" {
+		return "token"
+	}
+
+	return c.token
+}
+
+// anonymousMock is a credential without a token.
+type anonymousMock struct {
+	*credentialMock
+}
+
+func (c *anonymousMock) Token() string { return "" }
+
+func newEnterpriseServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/app/installations/2/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token":"installation-token"}`))
+	})
+	mux.HandleFunc("/api/v3/app/installations/2", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ey") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id":2,"app_id":1,"account":{"login":"foo","type":"Organization"},"repository_selection":"all","permissions":{"metadata":"read"}}`))
+	})
+	mux.HandleFunc("/api/v3/app/installations", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("Link", `<`+r.URL.Path+`?per_page=100&page=2>; rel="next"`)
+			w.Write([]byte(`[{"id":2,"app_id":1,"account":{"login":"foo","type":"Organization"}},{"id":3,"app_id":1,"account":{"login":"bar","type":"User"},"suspended_at":"2023-01-01T00:00:00Z"}]`))
+			return
+		}
+		w.Write([]byte(`[{"id":4,"app_id":1,"account":{"login":"baz","type":"User"}}]`))
+	})
+	mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"login":"octocat"}`))
+	})
+	mux.HandleFunc("/api/v3/rate_limit", func(w http.ResponseWriter, r *http.Request) {
+		// Only classic tokens have scopes.
+		if r.Header.Get("Authorization") == "Bearer token" {
+			w.Header().Set("X-OAuth-Scopes", "workflow, repo")
+		}
+		w.Header().Set("GitHub-Authentication-Token-Expiration", "2023-03-01 12:00:00 UTC")
+		w.Write([]byte(`{"resources":{"core":{"limit":5000,"remaining":4990,"reset":1700000000,"used":10},"search":{"limit":30,"remaining":18,"reset":1700000000}}}`))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestGitHubClient(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports public GitHub API host by default", func(t *testing.T) {
+		c, err := NewGitHubClientForPAT(&credentialMock{}, http.DefaultClient)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "api.github.com", c.metadata.apiHost)
+	})
+
+	t.Run("reads rate limits of PAT from GitHub Enterprise Server", func(t *testing.T) {
+		srv := newEnterpriseServer(t)
+		u, _ := url.Parse(srv.URL)
+		pat := &credentialMock{baseURL: srv.URL}
+
+		c, err := NewGitHubClientForPAT(pat, NewHTTPClientForPAT(context.Background(), pat))
+		if !assert.NoError(t, err) {
+			return
+		}
+		limits, err := c.RateLimits(context.Background())
+
+		if assert.NoError(t, err) && assert.Len(t, limits, 2) {
+			assert.Equal(t, "core", limits[0].Resource)
+			assert.Equal(t, 4990, limits[0].Remaining)
+			assert.Equal(t, 10, limits[0].Used)
+			assert.Equal(t, u.Host, limits[0].APIHost)
+			assert.WithinDuration(t, time.Now(), limits[0].Time, time.Second)
+		}
+	})
+
+	t.Run("describes classic PAT", func(t *testing.T) {
+		srv := newEnterpriseServer(t)
+		pat := &credentialMock{baseURL: srv.URL}
+
+		c, err := NewGitHubClientForPAT(pat, NewHTTPClientForPAT(context.Background(), pat))
+		if !assert.NoError(t, err) {
+			return
+		}
+		limits, err := c.RateLimits(context.Background())
+
+		if assert.NoError(t, err) && assert.Len(t, limits, 2) {
+			assert.Equal(t, &Token{
+				Kind:       TokenKindClassic,
+				Scopes:     []string{"repo", "workflow"},
+				Expiration: time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC),
+				Owner:      "octocat",
+			}, limits[0].Token)
+			assert.Same(t, limits[0].Token, limits[1].Token)
+		}
+	})
+
+	t.Run("does not read token owner again right after failure", func(t *testing.T) {
+		var calls int
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Resource not accessible by personal access token"}`))
+		})
+		mux.HandleFunc("/api/v3/rate_limit", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"resources":{"core":{"limit":5000,"remaining":4990,"reset":1700000000}}}`))
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+		pat := &credentialMock{baseURL: srv.URL}
+
+		c, err := NewGitHubClientForPAT(pat, http.DefaultClient)
+		if !assert.NoError(t, err) {
+			return
+		}
+		for i := 0; i < 3; i++ {
+			limits, err := c.RateLimits(context.Background())
+			if assert.NoError(t, err) && assert.Len(t, limits, 1) {
+				assert.Empty(t, limits[0].Token.Owner)
+			}
+		}
+		assert.Equal(t, 1, calls)
+
+		c.ownerRetryInterval = 0
+		c.RateLimits(context.Background())
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("describes fine-grained PAT", func(t *testing.T) {
+		srv := newEnterpriseServer(t)
+		pat := &credentialMock{baseURL: srv.URL, token: "github_pat_token"}
+
+		c, err := NewGitHubClientForPAT(pat, NewHTTPClientForPAT(context.Background(), pat))
+		if !assert.NoError(t, err) {
+			return
+		}
+		limits, err := c.RateLimits(context.Background())
+
+		if assert.NoError(t, err) && assert.Len(t, limits, 2) {
+			assert.Equal(t, TokenKindFineGrained, limits[0].Token.Kind)
+			assert.Empty(t, limits[0].Token.Scopes)
+		}
+	})
+
+	t.Run("does not authenticate without token", func(t *testing.T) {
+		var users int
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+			users++
+		})
+		mux.HandleFunc("/api/v3/rate_limit", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"resources":{"core":{"limit":60,"remaining":59,"reset":1700000000}}}`))
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+		pat := &anonymousMock{&credentialMock{baseURL: srv.URL}}
+
+		c, err := NewGitHubClientForPAT(pat, NewHTTPClientForPAT(context.Background(), pat))
+		if !assert.NoError(t, err) {
+			return
+		}
+		limits, err := c.RateLimits(context.Background())
+
+		if assert.NoError(t, err) && assert.Len(t, limits, 1) {
+			assert.Equal(t, 60, limits[0].Limit)
+			assert.Nil(t, limits[0].Token)
+		}
+		assert.Zero(t, users)
+	})
+
+	t.Run("derives used requests if GitHub doesn't report them", func(t *testing.T) {
+		srv := newEnterpriseServer(t)
+		pat := &credentialMock{baseURL: srv.URL}
+
+		c, err := NewGitHubClientForPAT(pat, NewHTTPClientForPAT(context.Background(), pat))
+		if !assert.NoError(t, err) {
+			return
+		}
+		limits, err := c.RateLimits(context.Background())
+
+		if assert.NoError(t, err) && assert.Len(t, limits, 2) {
+			assert.Equal(t, "search", limits[1].Resource)
+			assert.Equal(t, 12, limits[1].Used)
+		}
+	})
+
+	t.Run("returns GitHub errors", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"Bad credentials"}`))
+		}))
+		defer srv.Close()
+		pat := &credentialMock{baseURL: srv.URL}
+
+		c, err := NewGitHubClientForPAT(pat, http.DefaultClient)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = c.RateLimits(context.Background())
+
+		assert.True(t, IsAuthError(err))
+	})
+
+	t.Run("issues installation tokens on GitHub Enterprise Server", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := newEnterpriseServer(t)
+		app := &credentialMock{
+			baseURL: srv.URL,
+			key:     pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		}
+
+		client, err := NewHTTPClientForApp(app)
+		if !assert.NoError(t, err) {
+			return
+		}
+		c, err := NewGitHubClientForApp(app, client, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		limits, err := c.RateLimits(context.Background())
+
+		if assert.NoError(t, err) && assert.Len(t, limits, 2) {
+			assert.Nil(t, limits[0].Token)
+		}
+	})
+
+	t.Run("reads installation as the app", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := newEnterpriseServer(t)
+		app := &credentialMock{
+			baseURL: srv.URL,
+			key:     pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		}
+
+		client, err := NewHTTPClientForApp(app)
+		if !assert.NoError(t, err) {
+			return
+		}
+		appClient, err := NewHTTPClientForAppJWT(app)
+		if !assert.NoError(t, err) {
+			return
+		}
+		c, err := NewGitHubClientForApp(app, client, appClient)
+		if !assert.NoError(t, err) {
+			return
+		}
+		i, err := c.Installations(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, []*Installation{{
+			ID:                  2,
+			AppID:               1,
+			Account:             "foo",
+			AccountType:         "organization",
+			RepositorySelection: "all",
+			Permissions:         map[string]string{"metadata": "read"},
+		}}, i)
+	})
+
+	t.Run("lists active installations of the app", func(t *testing.T) {
+		srv := newEnterpriseServer(t)
+
+		installations, err := ListInstallations(context.Background(), &credentialMock{baseURL: srv.URL}, http.DefaultClient)
+
+		if assert.NoError(t, err) && assert.Len(t, installations, 2) {
+			assert.Equal(t, int64(2), installations[0].ID)
+			assert.Equal(t, "foo", installations[0].Account)
+			assert.Equal(t, int64(4), installations[1].ID)
+			assert.Equal(t, "user", installations[1].AccountType)
+		}
+	})
+
+	t.Run("cannot read installation without app client", func(t *testing.T) {
+		c, err := NewGitHubClientForApp(&credentialMock{}, http.DefaultClient, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = c.Installations(context.Background())
+
+		assert.ErrorIs(t, err, ErrNoAppClient)
+	})
+}
+
+func TestParseTokenExpiration(t *testing.T) {
+	for _, v := range []string{"2023-03-01 12:00:00 UTC", "2023-03-01 13:00:00 +0100"} {
+		exp, err := parseTokenExpiration(v)
+
+		if assert.NoError(t, err, v) {
+			assert.True(t, exp.Equal(time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)), v)
+		}
+	}
+
+	_, err := parseTokenExpiration("never")
+	assert.Error(t, err)
+}
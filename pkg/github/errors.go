@@ -0,0 +1,89 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v48/github"
+)
+
+// IsAuthError reports whether err was caused by GitHub API rejecting
+// the credentials, either when creating a GitHub App installation token
+// or when calling the API with a token.
+func IsAuthError(err error) bool {
+	var herr *ghinstallation.HTTPError
+	if errors.As(err, &herr) && herr.Response != nil {
+		return isAuthStatus(herr.Response.StatusCode)
+	}
+
+	var rerr *github.ErrorResponse
+	if errors.As(err, &rerr) && rerr.Response != nil {
+		return rerr.Response.StatusCode == http.StatusUnauthorized
+	}
+
+	return false
+}
+
+func isAuthStatus(code int) bool {
+	return code == http.StatusUnauthorized ||
+		code == http.StatusForbidden ||
+		code == http.StatusNotFound
+}
+
+// Classes of the errors returned by ErrorClass.
+const (
+	ErrorClassAuth        = "auth"
+	ErrorClassRateLimited = "rate_limited"
+	ErrorClass5xx         = "5xx"
+	ErrorClassNetwork     = "network"
+	ErrorClassOther       = "other"
+)
+
+// ErrorClass classifies err for reporting: rejected credentials, exceeded
+// primary or secondary rate limits, GitHub API server errors and network
+// errors. Other errors are classified as ErrorClassOther.
+func ErrorClass(err error) string {
+	if IsAuthError(err) {
+		return ErrorClassAuth
+	}
+
+	var rlerr *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	if errors.As(err, &rlerr) || errors.As(err, &abuse) {
+		return ErrorClassRateLimited
+	}
+
+	if code := statusCode(err); code == http.StatusTooManyRequests {
+		return ErrorClassRateLimited
+	} else if code >= 500 {
+		return ErrorClass5xx
+	}
+
+	var nerr net.Error
+	var uerr *url.Error
+	if errors.As(err, &nerr) || errors.As(err, &uerr) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassNetwork
+	}
+
+	return ErrorClassOther
+}
+
+// statusCode returns the HTTP status code of the GitHub API
+// response err was caused by or zero if there's none.
+func statusCode(err error) int {
+	var herr *ghinstallation.HTTPError
+	if errors.As(err, &herr) && herr.Response != nil {
+		return herr.Response.StatusCode
+	}
+
+	var rerr *github.ErrorResponse
+	if errors.As(err, &rerr) && rerr.Response != nil {
+		return rerr.Response.StatusCode
+	}
+
+	return 0
+}
@@ -0,0 +1,92 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v48/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAuthError(t *testing.T) {
+	t.Parallel()
+
+	t.Run("detects rejected token", func(t *testing.T) {
+		err := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnauthorized}}
+
+		assert.True(t, IsAuthError(err))
+	})
+
+	t.Run("detects failed installation token creation", func(t *testing.T) {
+		err := &ghinstallation.HTTPError{Response: &http.Response{StatusCode: http.StatusNotFound}}
+
+		assert.True(t, IsAuthError(err))
+	})
+
+	t.Run("ignores other errors", func(t *testing.T) {
+		err := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}
+
+		assert.False(t, IsAuthError(err))
+		assert.False(t, IsAuthError(errors.New("boom")))
+	})
+}
+
+func TestErrorClass(t *testing.T) {
+	t.Parallel()
+
+	response := func(code int) *http.Response {
+		return &http.Response{StatusCode: code, Request: &http.Request{}}
+	}
+
+	for name, tc := range map[string]struct {
+		err   error
+		class string
+	}{
+		"rejected token": {
+			err:   &github.ErrorResponse{Response: response(http.StatusUnauthorized)},
+			class: ErrorClassAuth,
+		},
+		"failed installation token creation": {
+			err:   &url.Error{Op: "Get", URL: "https://api.github.com", Err: &ghinstallation.HTTPError{Response: response(http.StatusForbidden)}},
+			class: ErrorClassAuth,
+		},
+		"exceeded rate limit": {
+			err:   &github.RateLimitError{Response: response(http.StatusForbidden)},
+			class: ErrorClassRateLimited,
+		},
+		"exceeded secondary rate limit": {
+			err:   &github.AbuseRateLimitError{Response: response(http.StatusForbidden)},
+			class: ErrorClassRateLimited,
+		},
+		"too many requests": {
+			err:   &github.ErrorResponse{Response: response(http.StatusTooManyRequests)},
+			class: ErrorClassRateLimited,
+		},
+		"server error": {
+			err:   &github.ErrorResponse{Response: response(http.StatusBadGateway)},
+			class: ErrorClass5xx,
+		},
+		"network error": {
+			err:   &url.Error{Op: "Get", URL: "https://api.github.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}},
+			class: ErrorClassNetwork,
+		},
+		"timeout": {
+			err:   context.DeadlineExceeded,
+			class: ErrorClassNetwork,
+		},
+		"other error": {
+			err:   errors.New("boom"),
+			class: ErrorClassOther,
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.class, ErrorClass(tc.err))
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package github
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// DecodePrivateKey returns the PEM encoded RSA private key of a GitHub App.
+// The key may be given as PEM, as GitHub provides it for download, or as
+// base64 encoded PEM. An error is returned if the key cannot be parsed.
+func DecodePrivateKey(key []byte) ([]byte, error) {
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		return nil, errors.New("private key is empty")
+	}
+
+	if !bytes.HasPrefix(key, []byte("-----BEGIN")) {
+		decoded, err := base64.StdEncoding.DecodeString(string(key))
+		if err != nil {
+			return nil, errors.New("private key is neither PEM nor base64 encoded PEM")
+		}
+		key = bytes.TrimSpace(decoded)
+	}
+
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("private key cannot be parsed: %w", err)
+	}
+
+	if _, ok := parsed.(*rsa.PrivateKey); !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+
+	return key, nil
+}
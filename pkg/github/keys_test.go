@@ -0,0 +1,82 @@
+package github
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodePrivateKey(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	t.Run("accepts PEM", func(t *testing.T) {
+		key, err := DecodePrivateKey(append(pkcs1, '\n'))
+
+		assert.NoError(t, err)
+		assert.Equal(t, string(pkcs1[:len(pkcs1)-1]), string(key))
+	})
+
+	t.Run("accepts base64 encoded PEM", func(t *testing.T) {
+		key, err := DecodePrivateKey([]byte(base64.StdEncoding.EncodeToString(pkcs1)))
+
+		assert.NoError(t, err)
+		assert.Equal(t, string(pkcs1[:len(pkcs1)-1]), string(key))
+	})
+
+	t.Run("accepts PKCS8", func(t *testing.T) {
+		b, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = DecodePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}))
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects empty key", func(t *testing.T) {
+		_, err := DecodePrivateKey([]byte(" \n"))
+
+		assert.EqualError(t, err, "private key is empty")
+	})
+
+	t.Run("rejects garbage", func(t *testing.T) {
+		_, err := DecodePrivateKey([]byte("not a key!"))
+
+		assert.EqualError(t, err, "private key is neither PEM nor base64 encoded PEM")
+	})
+
+	t.Run("rejects base64 encoded garbage", func(t *testing.T) {
+		_, err := DecodePrivateKey([]byte(base64.StdEncoding.EncodeToString([]byte("key"))))
+
+		assert.EqualError(t, err, "private key is not PEM encoded")
+	})
+
+	t.Run("rejects non-RSA keys", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := x509.MarshalPKCS8PrivateKey(ecKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = DecodePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}))
+
+		assert.EqualError(t, err, "private key is not an RSA key")
+	})
+}
@@ -0,0 +1,132 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v48/github"
+)
+
+// RetryPolicy retries failed GitHub API requests with jittered exponential
+// backoff. Server errors, network errors and exceeded rate limits are
+// retried, the latter after the time GitHub asks to wait for.
+type RetryPolicy struct {
+	// MaxRetries is the maximum amount of retries. Zero disables retries.
+	MaxRetries int
+	// MinBackoff is the backoff before the first retry.
+	MinBackoff time.Duration
+	// MaxBackoff caps the backoff, including the time GitHub asks to wait
+	// for. Requests are not retried if GitHub asks to wait for longer.
+	MaxBackoff time.Duration
+}
+
+// Do calls fn until it succeeds, returns an error which is not worth
+// retrying or the retries are exhausted. onRetry, if not nil, is called
+// before waiting for a retry. Do gives up early if the context would be
+// done before the retry.
+func (p RetryPolicy) Do(ctx context.Context, fn func(context.Context) error, onRetry func(err error, wait time.Duration)) error {
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		wait, ok := p.backoff(err, attempt)
+		if !ok {
+			return err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+
+		if onRetry != nil {
+			onRetry(err, wait)
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// backoff returns how long to wait before retrying
+// after err or false if err is not worth retrying.
+func (p RetryPolicy) backoff(err error, attempt int) (time.Duration, bool) {
+	switch ErrorClass(err) {
+	case ErrorClassRateLimited:
+		wait, ok := retryAfter(err)
+		if !ok {
+			break
+		}
+
+		return wait, wait <= p.MaxBackoff
+	case ErrorClass5xx, ErrorClassNetwork:
+	default:
+		return 0, false
+	}
+
+	backoff := p.MinBackoff << attempt
+	if backoff <= 0 || backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	// Full jitter within the upper half of the backoff.
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)), true
+}
+
+// retryAfter returns the time GitHub asks to wait for before
+// retrying a rate limited request, if it says so.
+func retryAfter(err error) (time.Duration, bool) {
+	var abuse *github.AbuseRateLimitError
+	if errors.As(err, &abuse) && abuse.RetryAfter != nil {
+		return *abuse.RetryAfter, true
+	}
+
+	var rlerr *github.RateLimitError
+	if errors.As(err, &rlerr) && !rlerr.Rate.Reset.IsZero() {
+		wait := time.Until(rlerr.Rate.Reset.Time)
+		if wait < 0 {
+			wait = 0
+		}
+
+		return wait, true
+	}
+
+	var rerr *github.ErrorResponse
+	if errors.As(err, &rerr) && rerr.Response != nil {
+		return parseRetryAfter(rerr.Response.Header)
+	}
+
+	return 0, false
+}
+
+func parseRetryAfter(h http.Header) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		wait := time.Until(t)
+		if wait < 0 {
+			wait = 0
+		}
+
+		return wait, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,120 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v48/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	response := func(code int, header http.Header) *http.Response {
+		return &http.Response{StatusCode: code, Header: header, Request: &http.Request{}}
+	}
+	failing := func(errs ...error) (func(context.Context) error, *int) {
+		calls := 0
+		return func(context.Context) error {
+			calls++
+			if calls <= len(errs) {
+				return errs[calls-1]
+			}
+
+			return nil
+		}, &calls
+	}
+
+	t.Run("retries server errors", func(t *testing.T) {
+		fn, calls := failing(
+			&github.ErrorResponse{Response: response(http.StatusBadGateway, nil)},
+			&github.ErrorResponse{Response: response(http.StatusServiceUnavailable, nil)},
+		)
+		var waits []time.Duration
+
+		err := policy.Do(context.Background(), fn, func(_ error, wait time.Duration) { waits = append(waits, wait) })
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, *calls)
+		if assert.Len(t, waits, 2) {
+			assert.LessOrEqual(t, waits[0], time.Millisecond)
+			assert.LessOrEqual(t, waits[1], 2*time.Millisecond)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		serverError := &github.ErrorResponse{Response: response(http.StatusBadGateway, nil)}
+		fn, calls := failing(serverError, serverError, serverError)
+
+		err := policy.Do(context.Background(), fn, nil)
+
+		assert.Equal(t, serverError, err)
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("doesn't retry other errors", func(t *testing.T) {
+		for _, retryErr := range []error{
+			&github.ErrorResponse{Response: response(http.StatusUnauthorized, nil)},
+			&github.ErrorResponse{Response: response(http.StatusUnprocessableEntity, nil)},
+			errors.New("boom"),
+		} {
+			fn, calls := failing(retryErr)
+
+			err := policy.Do(context.Background(), fn, nil)
+
+			assert.Equal(t, retryErr, err)
+			assert.Equal(t, 1, *calls)
+		}
+	})
+
+	t.Run("waits for Retry-After of secondary rate limit", func(t *testing.T) {
+		retryAfter := 20 * time.Millisecond
+		fn, calls := failing(&github.AbuseRateLimitError{Response: response(http.StatusForbidden, nil), RetryAfter: &retryAfter})
+		var wait time.Duration
+
+		err := policy.Do(context.Background(), fn, func(_ error, w time.Duration) { wait = w })
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, *calls)
+		assert.Equal(t, retryAfter, wait)
+	})
+
+	t.Run("waits for Retry-After header", func(t *testing.T) {
+		fn, calls := failing(&github.ErrorResponse{Response: response(http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}})})
+
+		err := policy.Do(context.Background(), fn, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("doesn't wait for longer than max backoff", func(t *testing.T) {
+		rlerr := &github.RateLimitError{
+			Response: response(http.StatusForbidden, nil),
+			Rate:     github.Rate{Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}},
+		}
+		fn, calls := failing(rlerr)
+
+		err := policy.Do(context.Background(), fn, nil)
+
+		assert.Equal(t, rlerr, err)
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("doesn't retry after the context deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		retryAfter := time.Second
+		fn, calls := failing(&github.AbuseRateLimitError{Response: response(http.StatusForbidden, nil), RetryAfter: &retryAfter})
+
+		err := RetryPolicy{MaxRetries: 2, MaxBackoff: time.Minute}.Do(ctx, fn, nil)
+
+		assert.Error(t, err)
+		assert.Equal(t, 1, *calls)
+	})
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+)
+
+// Readiness is implemented by exporter.Collector.
+type Readiness interface {
+	// Ready reports whether the first polling round has completed.
+	Ready() bool
+}
+
+// healthz reports that the exporter is alive. It doesn't
+// depend on GitHub API, so GitHub outages don't restart
+// the exporter.
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// readyz reports that the exporter is ready to be scraped, that is
+// the credentials have been loaded and the first polling round
+// has completed.
+func readyz(r Readiness) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if !r.Ready() {
+			http.Error(w, "first polling round has not completed", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok\n"))
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type readinessMock bool
+
+func (r readinessMock) Ready() bool { return bool(r) }
+
+func TestHealthz(t *testing.T) {
+	rr := httptest.NewRecorder()
+	healthz(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestReadyz(t *testing.T) {
+	t.Run("is not ready before the first polling round", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		readyz(readinessMock(false)).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+
+	t.Run("is ready after the first polling round", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		readyz(readinessMock(true)).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "ok\n", rr.Body.String())
+	})
+}
@@ -12,20 +12,45 @@ import (
 	"go.uber.org/fx"
 )
 
+// Port is the port the server listens on by default.
 const Port = "8080"
 
-func NewHTTPServer(lc fx.Lifecycle, mux *http.ServeMux, log logger.Logger) *http.Server {
-	srv := &http.Server{Addr: ":" + Port, Handler: mux}
+// ListenAddress is the address the server listens on, e.g. ":8080".
+type ListenAddress string
 
-	lc.Append(fx.Hook{
+type HTTPServerParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Mux       *http.ServeMux
+	Address   *ListenAddress
+	WebConfig *WebConfig
+	Log       logger.Logger
+}
+
+func NewHTTPServer(p HTTPServerParams) (*http.Server, error) {
+	tlsConfig, err := p.WebConfig.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{Addr: string(*p.Address), Handler: p.Mux, TLSConfig: tlsConfig}
+	log := p.Log
+
+	p.Lifecycle.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			ln, err := net.Listen("tcp", srv.Addr)
 			if err != nil {
 				return err
 			}
 
-			log.Infof("Starting HTTP server at %v", srv.Addr)
-			go srv.Serve(ln)
+			if srv.TLSConfig != nil {
+				log.Infow("starting HTTPS server", "address", srv.Addr)
+				go srv.ServeTLS(ln, "", "")
+			} else {
+				log.Infow("starting HTTP server", "address", srv.Addr)
+				go srv.Serve(ln)
+			}
 
 			return nil
 		},
@@ -34,28 +59,42 @@ func NewHTTPServer(lc fx.Lifecycle, mux *http.ServeMux, log logger.Logger) *http
 		},
 	})
 
-	return srv
+	return srv, nil
 }
 
 type ServerMuxParams struct {
 	fx.In
 
 	Handler      *exporter.MetricsHandler
+	Probe        *exporter.ProbeHandler
+	Collector    *exporter.Collector
 	Registry     *prometheus.Registry
 	Instrumenter metrics.HTTPHandlerInstrumenter
+	WebConfig    *WebConfig
 }
 
 func NewServeMux(p ServerMuxParams) *http.ServeMux {
-	h := p.Instrumenter.Instrument("/metrics", p.Handler)
+	h := p.Instrumenter.Instrument("/metrics", p.WebConfig.Authenticate(p.Handler))
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", h)
+	mux.Handle("/probe", p.Instrumenter.Instrument("/probe", p.WebConfig.Authenticate(p.Probe)))
+	mux.Handle("/", p.Instrumenter.Instrument("/", p.WebConfig.Authenticate(landing(p.Collector))))
+	mux.Handle("/status.json", p.Instrumenter.Instrument("/status.json", p.WebConfig.Authenticate(status(p.Collector))))
+	// Probes are not authenticated, kubelet can't authenticate anyway.
+	mux.Handle("/healthz", p.Instrumenter.Instrument("/healthz", http.HandlerFunc(healthz)))
+	mux.Handle("/readyz", p.Instrumenter.Instrument("/readyz", readyz(p.Collector)))
 
 	return mux
 }
 
 func Module() fx.Option {
+	addr := ListenAddress(":" + Port)
+	wc := WebConfigFile("")
+
 	return fx.Options(
+		fx.Supply(&addr, &wc),
 		fx.Provide(
+			NewWebConfig,
 			NewServeMux,
 			NewHTTPServer,
 		),
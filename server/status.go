@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/exporter"
+)
+
+// StatusReporter is implemented by exporter.Collector.
+type StatusReporter interface {
+	// Status returns the collection status of the credentials.
+	Status() []exporter.CredentialStatus
+}
+
+var landingPage = template.Must(template.New("landing").Funcs(template.FuncMap{
+	"time": func(t *time.Time) string {
+		if t == nil {
+			return "never"
+		}
+
+		return t.UTC().Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>GitHub Rate Limit Exporter</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>GitHub Rate Limit Exporter</h1>
+<p><a href="/metrics">Metrics</a> · <a href="/status.json">Status</a> · <a href="/healthz">Liveness</a> · <a href="/readyz">Readiness</a></p>
+<h2>Credentials</h2>
+{{- range . }}
+<h3>{{ .Name }}</h3>
+<table>
+<tr><th>Type</th><td>{{ .Type }}</td></tr>
+{{- if .AppID }}
+<tr><th>App ID</th><td>{{ .AppID }}</td></tr>
+<tr><th>Installation ID</th><td>{{ .InstallationID }}</td></tr>
+{{- end }}
+{{- if .BaseURL }}
+<tr><th>Base URL</th><td>{{ .BaseURL }}</td></tr>
+{{- end }}
+<tr><th>Last collection</th><td>{{ time .LastCollection }}</td></tr>
+<tr><th>Last success</th><td>{{ time .LastSuccess }}</td></tr>
+{{- if .LastError }}
+<tr><th>Last error</th><td class="error">{{ .LastError }} ({{ .ErrorClass }})</td></tr>
+{{- end }}
+</table>
+{{- if .RateLimits }}
+<table>
+<tr><th>Resource</th><th>Installation</th><th>Remaining</th><th>Limit</th><th>Reset</th></tr>
+{{- range .RateLimits }}
+<tr><td>{{ .Resource }}</td><td>{{ .InstallationID }}</td><td>{{ .Remaining }}</td><td>{{ .Limit }}</td><td>{{ .Reset.UTC.Format "2006-01-02T15:04:05Z07:00" }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- else }}
+<p>No credentials configured.</p>
+{{- end }}
+</body>
+</html>
+`))
+
+// landing renders the HTML landing page with the status of the credentials.
+func landing(s StatusReporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The landing page is registered on "/", which matches every path.
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := landingPage.Execute(w, s.Status()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// status responds with the status of the credentials as JSON.
+func status(s StatusReporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Credentials []exporter.CredentialStatus `json:"credentials"`
+		}{s.Status()})
+	}
+}
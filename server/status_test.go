@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ragnarpa/gh-rate-limit-exporter/pkg/exporter"
+	"github.com/stretchr/testify/assert"
+)
+
+type statusReporterMock []exporter.CredentialStatus
+
+func (s statusReporterMock) Status() []exporter.CredentialStatus { return s }
+
+func newStatusReporterMock() statusReporterMock {
+	collected := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	return statusReporterMock{
+		{
+			Name:           "my-app",
+			Type:           "gh-app",
+			AppID:          1,
+			InstallationID: 2,
+			LastCollection: &collected,
+			LastSuccess:    &collected,
+			RateLimits:     []exporter.ResourceLimit{{Resource: "core", InstallationID: "2", Limit: 5000, Remaining: 4999, Used: 1}},
+		},
+		{
+			Name:           "my-pat",
+			Type:           "gh-pat",
+			LastCollection: &collected,
+			LastError:      "GET https://api.github.com/rate_limit: 401 Bad credentials []",
+			ErrorClass:     "auth",
+		},
+	}
+}
+
+func TestLanding(t *testing.T) {
+	t.Run("lists credentials", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		landing(newStatusReporterMock()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+		body := rr.Body.String()
+		assert.Contains(t, body, "<h3>my-app</h3>")
+		assert.Contains(t, body, "<td>core</td><td>2</td><td>4999</td><td>5000</td>")
+		assert.Contains(t, body, "2023-01-02T03:04:05Z")
+		assert.Contains(t, body, "<h3>my-pat</h3>")
+		assert.Contains(t, body, "401 Bad credentials [] (auth)")
+	})
+
+	t.Run("responds not found for other paths", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		landing(newStatusReporterMock()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestStatus(t *testing.T) {
+	rr := httptest.NewRecorder()
+	status(newStatusReporterMock()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+
+	var body struct {
+		Credentials []exporter.CredentialStatus `json:"credentials"`
+	}
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	if assert.NoError(t, json.NewDecoder(rr.Body).Decode(&body)) {
+		assert.Equal(t, []exporter.CredentialStatus(newStatusReporterMock()), body.Credentials)
+	}
+}
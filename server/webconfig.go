@@ -0,0 +1,237 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// WebConfigFile is the path of the web configuration file. The format
+// follows the Prometheus exporter-toolkit web configuration file with
+// an additional bearer_token_file option.
+type WebConfigFile string
+
+type (
+	TLSServerConfig struct {
+		CertFile     string `yaml:"cert_file"`
+		KeyFile      string `yaml:"key_file"`
+		ClientCAFile string `yaml:"client_ca_file"`
+		MinVersion   string `yaml:"min_version"`
+	}
+
+	WebConfig struct {
+		TLSServerConfig *TLSServerConfig  `yaml:"tls_server_config"`
+		BasicAuthUsers  map[string]string `yaml:"basic_auth_users"`
+		BearerTokenFile string            `yaml:"bearer_token_file"`
+
+		tokenMtx     sync.Mutex
+		bearerToken  []byte
+		tokenModTime time.Time
+		verified     sync.Map
+	}
+)
+
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// NewWebConfig reads the web configuration from given file. Empty path
+// results in plain HTTP without authentication.
+func NewWebConfig(path *WebConfigFile) (*WebConfig, error) {
+	wc := &WebConfig{}
+	if path == nil || *path == "" {
+		return wc, nil
+	}
+
+	b, err := os.ReadFile(string(*path))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(b, wc); err != nil {
+		return nil, fmt.Errorf("web config %v: %w", *path, err)
+	}
+
+	if wc.BearerTokenFile != "" {
+		if err := wc.loadBearerToken(); err != nil {
+			return nil, fmt.Errorf("web config %v: %w", *path, err)
+		}
+	}
+
+	if _, err := wc.TLSConfig(); err != nil {
+		return nil, fmt.Errorf("web config %v: %w", *path, err)
+	}
+
+	return wc, nil
+}
+
+// TLSConfig returns the TLS configuration of the server or nil if TLS is
+// not configured. The certificate and key are read from disk on every
+// handshake so that renewed certificates are picked up without restarts.
+func (wc *WebConfig) TLSConfig() (*tls.Config, error) {
+	c := wc.TLSServerConfig
+	if c == nil {
+		return nil, nil
+	}
+
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("both cert_file and key_file must be set")
+	}
+
+	// Fail early if the certificate cannot be loaded.
+	if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+
+			return &cert, nil
+		},
+	}
+
+	if c.MinVersion != "" {
+		v, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown min_version: %v", c.MinVersion)
+		}
+		cfg.MinVersion = v
+	}
+
+	if c.ClientCAFile != "" {
+		b, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %v", c.ClientCAFile)
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// loadBearerToken reads the bearer token file if it has changed since
+// it was read last. The previous token is kept if the file cannot be read.
+func (wc *WebConfig) loadBearerToken() error {
+	fi, err := os.Stat(wc.BearerTokenFile)
+	if err != nil {
+		return err
+	}
+
+	wc.tokenMtx.Lock()
+	defer wc.tokenMtx.Unlock()
+
+	if fi.ModTime().Equal(wc.tokenModTime) {
+		return nil
+	}
+
+	b, err := os.ReadFile(wc.BearerTokenFile)
+	if err != nil {
+		return err
+	}
+
+	token := []byte(strings.TrimSpace(string(b)))
+	if len(token) == 0 {
+		return fmt.Errorf("bearer token file %v is empty", wc.BearerTokenFile)
+	}
+
+	wc.bearerToken = token
+	wc.tokenModTime = fi.ModTime()
+
+	return nil
+}
+
+// token returns the bearer token. The token file is re-read whenever
+// it changes so that rotated tokens are picked up without restarts.
+func (wc *WebConfig) token() []byte {
+	if wc.BearerTokenFile == "" {
+		return nil
+	}
+
+	// Keep the previous token if the rotated one cannot be read.
+	wc.loadBearerToken()
+
+	wc.tokenMtx.Lock()
+	defer wc.tokenMtx.Unlock()
+
+	return wc.bearerToken
+}
+
+// Authenticate wraps the handler with basic or bearer authentication
+// if any is configured. Otherwise the handler is returned as is.
+func (wc *WebConfig) Authenticate(h http.Handler) http.Handler {
+	if len(wc.BasicAuthUsers) == 0 && wc.BearerTokenFile == "" {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wc.authorized(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if len(wc.BasicAuthUsers) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gh-rate-limit-exporter"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func (wc *WebConfig) authorized(r *http.Request) bool {
+	if expected := wc.token(); len(expected) > 0 {
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token != auth && subtle.ConstantTimeCompare([]byte(token), expected) == 1 {
+			return true
+		}
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	hash, ok := wc.BasicAuthUsers[user]
+	if !ok {
+		return false
+	}
+
+	// bcrypt is slow on purpose, so remember
+	// the successfully verified credentials.
+	key := sha256.Sum256([]byte(user + ":" + pass + ":" + hash))
+	if _, ok := wc.verified.Load(key); ok {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+		return false
+	}
+	wc.verified.Store(key, struct{}{})
+
+	return true
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return path
+}
+
+func newWebConfig(t *testing.T, config string) *WebConfig {
+	path := WebConfigFile(writeFile(t, "web.yml", []byte(config)))
+	wc, err := NewWebConfig(&path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return wc
+}
+
+func serve(h http.Handler, setup func(*http.Request)) int {
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	setup(req)
+	h.ServeHTTP(rr, req)
+
+	return rr.Result().StatusCode
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestWebConfig(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no web config serves plain HTTP without authentication", func(t *testing.T) {
+		empty := WebConfigFile("")
+		wc, err := NewWebConfig(&empty)
+		tc, tlsErr := wc.TLSConfig()
+
+		assert.NoError(t, err)
+		assert.NoError(t, tlsErr)
+		assert.Nil(t, tc)
+		assert.Equal(t, http.StatusOK, serve(wc.Authenticate(okHandler), func(*http.Request) {}))
+	})
+
+	t.Run("requires basic auth for configured users", func(t *testing.T) {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		h := newWebConfig(t, "basic_auth_users:\n  alice: "+string(hash)+"\n").Authenticate(okHandler)
+
+		assert.Equal(t, http.StatusUnauthorized, serve(h, func(*http.Request) {}))
+		assert.Equal(t, http.StatusUnauthorized, serve(h, func(r *http.Request) { r.SetBasicAuth("alice", "wrong") }))
+		assert.Equal(t, http.StatusUnauthorized, serve(h, func(r *http.Request) { r.SetBasicAuth("bob", "secret") }))
+		assert.Equal(t, http.StatusOK, serve(h, func(r *http.Request) { r.SetBasicAuth("alice", "secret") }))
+		assert.Equal(t, http.StatusOK, serve(h, func(r *http.Request) { r.SetBasicAuth("alice", "secret") }))
+	})
+
+	t.Run("requires bearer token from token file", func(t *testing.T) {
+		token := writeFile(t, "token", []byte("s3cr3t\n"))
+		h := newWebConfig(t, "bearer_token_file: "+token+"\n").Authenticate(okHandler)
+
+		assert.Equal(t, http.StatusUnauthorized, serve(h, func(*http.Request) {}))
+		assert.Equal(t, http.StatusUnauthorized, serve(h, func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }))
+		assert.Equal(t, http.StatusOK, serve(h, func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cr3t") }))
+	})
+
+	t.Run("reloads bearer token file when it changes", func(t *testing.T) {
+		token := writeFile(t, "token", []byte("s3cr3t\n"))
+		h := newWebConfig(t, "bearer_token_file: "+token+"\n").Authenticate(okHandler)
+
+		assert.Equal(t, http.StatusOK, serve(h, func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cr3t") }))
+
+		if err := os.WriteFile(token, []byte("r0t4t3d\n"), 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(token, later, later); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, serve(h, func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cr3t") }))
+		assert.Equal(t, http.StatusOK, serve(h, func(r *http.Request) { r.Header.Set("Authorization", "Bearer r0t4t3d") }))
+	})
+
+	t.Run("returns error with missing certificate", func(t *testing.T) {
+		path := WebConfigFile(writeFile(t, "web.yml", []byte("tls_server_config:\n  cert_file: /does/not/exist\n  key_file: /does/not/exist\n")))
+		wc, err := NewWebConfig(&path)
+
+		assert.Nil(t, wc)
+		assert.Error(t, err)
+	})
+
+	t.Run("serves TLS with configured certificate", func(t *testing.T) {
+		cert, key := generateCertificate(t)
+		wc := newWebConfig(t, "tls_server_config:\n  cert_file: "+cert+"\n  key_file: "+key+"\n  min_version: TLS13\n")
+
+		srv := httptest.NewUnstartedServer(okHandler)
+		tc, err := wc.TLSConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		srv.TLS = tc
+		srv.StartTLS()
+		defer srv.Close()
+
+		resp, err := srv.Client().Get(srv.URL)
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.NotEmpty(t, resp.TLS.PeerCertificates)
+		}
+	})
+}
+
+func generateCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cert := writeFile(t, "cert.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyFile := writeFile(t, "key.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+
+	return cert, keyFile
+}